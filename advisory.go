@@ -0,0 +1,298 @@
+package pkgthing
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/johnny-morrice/godless/api"
+	"github.com/johnny-morrice/godless/crdt"
+	"github.com/johnny-morrice/godless/query"
+	"github.com/pkg/errors"
+)
+
+// Advisory marks a range of versions of a package as vulnerable. A version is
+// affected if it is listed in Versions, or is at least Introduced (when set)
+// and below Fixed (when set).
+type Advisory struct {
+	ID         string
+	System     string
+	Name       string
+	Severity   string
+	Summary    string
+	Introduced string
+	Fixed      string
+	Versions   []string
+}
+
+func (advisory Advisory) Affects(version string) bool {
+	for _, v := range advisory.Versions {
+		if CompareVersions(v, version) == 0 {
+			return true
+		}
+	}
+
+	if advisory.Introduced == "" && advisory.Fixed == "" {
+		return len(advisory.Versions) == 0
+	}
+
+	if advisory.Introduced != "" && CompareVersions(version, advisory.Introduced) < 0 {
+		return false
+	}
+
+	if advisory.Fixed != "" && CompareVersions(version, advisory.Fixed) >= 0 {
+		return false
+	}
+
+	return true
+}
+
+type AdvisoryDatabase struct {
+	Godless api.Client
+}
+
+func (db AdvisoryDatabase) Add(advisory Advisory) error {
+	const errMsg = "AdvisoryDatabase.Add failed"
+
+	if advisory.ID == "" || advisory.System == "" || advisory.Name == "" {
+		return errors.New(errMsg + ": advisory must have ID, System and Name")
+	}
+
+	text, err := json.Marshal(advisory)
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	entries := map[crdt.EntryName]crdt.PointText{
+		__ADVISORY_KEY: crdt.PointText(text),
+	}
+
+	q := joinQuery(advisoryTable(advisory.System), advisory.Name, entries)
+	_, err = db.Godless.Send(api.MakeQueryRequest(q))
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	return nil
+}
+
+func (db AdvisoryDatabase) ForSystem(system string) ([]Advisory, error) {
+	const errMsg = "AdvisoryDatabase.ForSystem failed"
+
+	q, err := query.Compile("select ??", advisoryTable(system))
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	resp, err := db.Godless.Send(api.MakeQueryRequest(q))
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	advisories := []Advisory{}
+	resp.Namespace.ForeachRow(func(t crdt.TableName, r crdt.RowName, row crdt.Row) {
+		forEachPoint(row, __ADVISORY_KEY, func(text []byte) {
+			advisory := Advisory{}
+
+			if json.Unmarshal(text, &advisory) == nil {
+				advisories = append(advisories, advisory)
+			}
+		})
+	})
+
+	return advisories, nil
+}
+
+type Finding struct {
+	Package  PackageInfo
+	Advisory Advisory
+}
+
+// AuditHost reports the listed packages that have a known advisory.
+func AuditHost(lister PackageLister, db AdvisoryDatabase) ([]Finding, error) {
+	const errMsg = "AuditHost failed"
+
+	installed, err := lister.GetInstalledPackages()
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	bySystem := map[string]map[string][]Advisory{}
+	findings := []Finding{}
+
+	for _, info := range installed {
+		advisories, ok := bySystem[info.System]
+
+		if !ok {
+			list, err := db.ForSystem(info.System)
+
+			if err != nil {
+				return nil, errors.Wrap(err, errMsg)
+			}
+
+			advisories = map[string][]Advisory{}
+			for _, advisory := range list {
+				advisories[advisory.Name] = append(advisories[advisory.Name], advisory)
+			}
+
+			bySystem[info.System] = advisories
+		}
+
+		version := info.GetMetaData(VERSION_KEY)
+		for _, advisory := range advisories[info.Name] {
+			if advisory.Affects(version) {
+				finding := Finding{
+					Package:  info,
+					Advisory: advisory,
+				}
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	return findings, nil
+}
+
+type osvRecord struct {
+	ID               string
+	Summary          string
+	Severity         []osvSeverity
+	Affected         []osvAffected
+	DatabaseSpecific osvSpecific `json:"database_specific"`
+}
+
+type osvSeverity struct {
+	Type  string
+	Score string
+}
+
+type osvSpecific struct {
+	Severity string
+}
+
+type osvAffected struct {
+	Package           osvPackage
+	Ranges            []osvRange
+	Versions          []string
+	EcosystemSpecific osvSpecific `json:"ecosystem_specific"`
+}
+
+type osvPackage struct {
+	Ecosystem string
+	Name      string
+}
+
+type osvRange struct {
+	Type   string
+	Events []osvEvent
+}
+
+type osvEvent struct {
+	Introduced string
+	Fixed      string
+}
+
+// ReadOSV converts an OSV-format JSON record into advisories for system. When
+// ecosystem is set, affected packages from other ecosystems are skipped.
+func ReadOSV(r io.Reader, system, ecosystem string) ([]Advisory, error) {
+	record := osvRecord{}
+	err := json.NewDecoder(r).Decode(&record)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadOSV failed")
+	}
+
+	advisories := []Advisory{}
+	for _, affected := range record.Affected {
+		if ecosystem != "" && !strings.EqualFold(affected.Package.Ecosystem, ecosystem) {
+			continue
+		}
+
+		template := Advisory{
+			ID:       record.ID,
+			System:   system,
+			Name:     affected.Package.Name,
+			Severity: osvSeverityText(record, affected),
+			Summary:  record.Summary,
+		}
+
+		if len(affected.Versions) > 0 {
+			advisory := template
+			advisory.Versions = affected.Versions
+			advisories = append(advisories, advisory)
+		}
+
+		for _, r := range affected.Ranges {
+			if r.Type == __OSV_GIT_RANGE {
+				continue
+			}
+
+			advisories = append(advisories, osvRangeAdvisories(template, r)...)
+		}
+	}
+
+	return advisories, nil
+}
+
+func osvRangeAdvisories(template Advisory, r osvRange) []Advisory {
+	advisories := []Advisory{}
+	open := false
+	current := template
+
+	for _, event := range r.Events {
+		if event.Introduced != "" {
+			current = template
+			open = true
+
+			if event.Introduced != __OSV_ZERO_VERSION {
+				current.Introduced = event.Introduced
+			}
+		}
+
+		if event.Fixed != "" && open {
+			current.Fixed = event.Fixed
+			advisories = append(advisories, current)
+			open = false
+		}
+	}
+
+	if open {
+		advisories = append(advisories, current)
+	}
+
+	return advisories
+}
+
+func osvSeverityText(record osvRecord, affected osvAffected) string {
+	if affected.EcosystemSpecific.Severity != "" {
+		return affected.EcosystemSpecific.Severity
+	}
+
+	if record.DatabaseSpecific.Severity != "" {
+		return record.DatabaseSpecific.Severity
+	}
+
+	if len(record.Severity) > 0 {
+		return record.Severity[0].Score
+	}
+
+	return ""
+}
+
+func advisoryTable(system string) string {
+	if system == "" {
+		panic("BUG system was empty")
+	}
+
+	return __ADVISORY_TABLE_PREFIX + system
+}
+
+const __ADVISORY_TABLE_PREFIX = "advisory_"
+const __ADVISORY_KEY = "advisory"
+const __OSV_GIT_RANGE = "GIT"
+const __OSV_ZERO_VERSION = "0"
@@ -0,0 +1,604 @@
+package pkgthing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/eddsa"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+)
+
+// AptRepository serves the packages of one system as an APT repository:
+//
+//	dists/<suite>/{Release,InRelease,Release.gpg}
+//	dists/<suite>/<component>/binary-<arch>/Packages[.gz]
+//	pool/<component>/<prefix>/<name>/<hash>/<name>_<version>_<arch>.deb
+//	pubkey.gpg
+//
+// Packages need VERSION_KEY and ARCHITECTURE_KEY metadata, as recorded by the
+// Ubuntu sync. The index is rebuilt at most once per RefreshInterval, from
+// the sizes and sums recorded when packages were added.
+type AptRepository struct {
+	Searcher        PackageSearcher
+	Getter          PackageGetter
+	System          string
+	Suite           string
+	Component       string
+	Origin          string
+	SigningKey      *openpgp.Entity
+	RefreshInterval time.Duration
+	Logger          Logger
+}
+
+// MakeAptSigningKey derives an OpenPGP key from a pkgthing key, so that APT
+// can check Release files signed by the pkgthing key. It is a v4 EdDSA key,
+// which gpgv understands, created at a fixed time so that its fingerprint
+// does not change between runs.
+func MakeAptSigningKey(key Ed25519Key, name string) (*openpgp.Entity, error) {
+	const errMsg = "MakeAptSigningKey failed"
+
+	public, err := readEdDSAPublicKey(key.Private.Public().(ed25519.PublicKey))
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	private := eddsa.NewPrivateKey(*public)
+	err = private.UnmarshalByteSecret(key.Private.Seed())
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	entity := &openpgp.Entity{
+		PrivateKey: packet.NewSignerPrivateKey(__APT_KEY_CREATED, private),
+		Identities: map[string]*openpgp.Identity{},
+	}
+	entity.PrimaryKey = &entity.PrivateKey.PublicKey
+
+	config := &packet.Config{
+		Time: func() time.Time { return __APT_KEY_CREATED },
+	}
+	err = entity.AddUserId(name, key.Reference().String(), "", config)
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	return entity, nil
+}
+
+// readEdDSAPublicKey parses a public key packet for point, because the
+// OpenPGP library only makes legacy EdDSA keys by generating or reading them.
+func readEdDSAPublicKey(point ed25519.PublicKey) (*eddsa.PublicKey, error) {
+	body := &bytes.Buffer{}
+	body.WriteByte(4)
+	binary.Write(body, binary.BigEndian, uint32(__APT_KEY_CREATED.Unix()))
+	body.WriteByte(byte(packet.PubKeyAlgoEdDSA))
+	body.WriteByte(byte(len(__ED25519_OID)))
+	body.Write(__ED25519_OID)
+	// The point is an MPI of 0x40 followed by the key, 263 bits long.
+	body.Write([]byte{0x01, 0x07, 0x40})
+	body.Write(point)
+
+	encoded := append([]byte{0xc0 | byte(__PGP_PUBLIC_KEY_TAG), byte(body.Len())}, body.Bytes()...)
+	parsed, err := packet.Read(bytes.NewReader(encoded))
+
+	if err != nil {
+		return nil, err
+	}
+
+	public, ok := parsed.(*packet.PublicKey)
+
+	if !ok {
+		return nil, errors.New("Not a public key")
+	}
+
+	eddsaPublic, ok := public.PublicKey.(*eddsa.PublicKey)
+
+	if !ok {
+		return nil, errors.New("Not an EdDSA public key")
+	}
+
+	return eddsaPublic, nil
+}
+
+func (repo AptRepository) Handler() http.Handler {
+	if repo.Suite == "" {
+		repo.Suite = __DEFAULT_APT_SUITE
+	}
+
+	if repo.Component == "" {
+		repo.Component = __DEFAULT_APT_COMPONENT
+	}
+
+	if repo.Origin == "" {
+		repo.Origin = __DEFAULT_APT_ORIGIN
+	}
+
+	if repo.RefreshInterval <= 0 {
+		repo.RefreshInterval = __DEFAULT_APT_REFRESH
+	}
+
+	repo.Logger = useLogger(repo.Logger)
+
+	return &aptServer{
+		repo:  repo,
+		files: map[string]aptFile{},
+	}
+}
+
+type aptServer struct {
+	repo  AptRepository
+	mutex sync.Mutex
+	index *aptIndex
+	// building is held while the index is rebuilt, so that requests are
+	// served from the old index meanwhile.
+	building sync.Mutex
+	// files caches package sizes and sums by IpfsPath, for packages
+	// published without them. It is only used while holding building.
+	files map[string]aptFile
+}
+
+type aptFile struct {
+	Size   int64
+	SHA256 string
+}
+
+type aptIndex struct {
+	built time.Time
+	files map[string][]byte
+	pool  map[string]PackageInfo
+}
+
+func (server *aptServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	index, err := server.getIndex()
+
+	if err != nil {
+		server.repo.Logger.Log(LOG_ERROR, "Failed to build apt index", LogField{Key: "system", Value: server.repo.System}, errorField(err))
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	filePath := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+
+	if info, ok := index.pool[filePath]; ok {
+		server.servePackage(w, r, info)
+		return
+	}
+
+	if data, ok := index.files[filePath]; ok {
+		http.ServeContent(w, r, path.Base(filePath), index.built, bytes.NewReader(data))
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+func (server *aptServer) servePackage(w http.ResponseWriter, r *http.Request, info PackageInfo) {
+	pack, err := server.repo.Getter.Get(info)
+
+	if err != nil {
+		server.repo.Logger.Log(LOG_ERROR, "Failed to get package", packageFields(info, errorField(err))...)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", __DEB_CONTENT_TYPE)
+	http.ServeContent(w, r, aptFileName(info), info.Published, bytes.NewReader(pack.Data))
+}
+
+func (server *aptServer) getIndex() (*aptIndex, error) {
+	index := server.currentIndex()
+
+	if server.isFresh(index) {
+		return index, nil
+	}
+
+	if index == nil {
+		server.building.Lock()
+	} else if !server.building.TryLock() {
+		return index, nil
+	}
+
+	defer server.building.Unlock()
+
+	// Another request may have rebuilt the index while we waited.
+	index = server.currentIndex()
+
+	if server.isFresh(index) {
+		return index, nil
+	}
+
+	index, err := server.buildIndex()
+
+	if err != nil {
+		return nil, err
+	}
+
+	server.mutex.Lock()
+	server.index = index
+	server.mutex.Unlock()
+
+	return index, nil
+}
+
+func (server *aptServer) currentIndex() *aptIndex {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.index
+}
+
+func (server *aptServer) isFresh(index *aptIndex) bool {
+	return index != nil && time.Since(index.built) < server.repo.RefreshInterval
+}
+
+func (server *aptServer) buildIndex() (*aptIndex, error) {
+	const errMsg = "buildIndex failed"
+
+	repo := server.repo
+
+	term := PackageSearchTerm{
+		SearchKey: SEARCH_SYSTEM,
+		System:    repo.System,
+	}
+
+	found, err := repo.Searcher.Search(term)
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	packages, err := aptPackages(found)
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	index := &aptIndex{
+		built: time.Now().UTC(),
+		files: map[string][]byte{},
+		pool:  map[string]PackageInfo{},
+	}
+
+	stanzas := map[string][]string{}
+	archs := []string{}
+	for _, info := range packages {
+		file, err := server.stat(info)
+
+		if err != nil {
+			repo.Logger.Log(LOG_WARN, "Skipping package in apt index", packageFields(info, errorField(err))...)
+			continue
+		}
+
+		poolPath := repo.poolPath(info)
+		index.pool[poolPath] = info
+
+		arch := info.GetMetaData(ARCHITECTURE_KEY)
+		if _, present := stanzas[arch]; !present && arch != __APT_ALL_ARCH {
+			archs = append(archs, arch)
+		}
+
+		stanzas[arch] = append(stanzas[arch], aptStanza(info, poolPath, file))
+	}
+
+	sort.Strings(archs)
+
+	if len(archs) == 0 {
+		archs = []string{__APT_ALL_ARCH}
+	}
+
+	distPath := path.Join("dists", repo.Suite)
+	indexFiles := []string{}
+	for _, arch := range archs {
+		entries := stanzas[arch]
+		if arch != __APT_ALL_ARCH {
+			entries = append(entries, stanzas[__APT_ALL_ARCH]...)
+		}
+
+		packagesText := []byte(strings.Join(entries, "\n"))
+		packagesGz, err := gzipData(packagesText)
+
+		if err != nil {
+			return nil, errors.Wrap(err, errMsg)
+		}
+
+		binaryPath := path.Join(repo.Component, "binary-"+arch)
+		index.files[path.Join(distPath, binaryPath, "Packages")] = packagesText
+		index.files[path.Join(distPath, binaryPath, "Packages.gz")] = packagesGz
+		indexFiles = append(indexFiles, path.Join(binaryPath, "Packages"), path.Join(binaryPath, "Packages.gz"))
+	}
+
+	release := repo.release(index, distPath, indexFiles, archs)
+	index.files[path.Join(distPath, "Release")] = release
+
+	if repo.SigningKey != nil {
+		err = repo.signRelease(index, distPath, release)
+
+		if err != nil {
+			return nil, errors.Wrap(err, errMsg)
+		}
+	}
+
+	return index, nil
+}
+
+// stat uses the size and sum recorded when the package was added, and only
+// downloads packages added without them.
+func (server *aptServer) stat(info PackageInfo) (aptFile, error) {
+	if file, ok := recordedAptFile(info); ok {
+		return file, nil
+	}
+
+	if file, ok := server.files[info.IpfsPath]; ok {
+		return file, nil
+	}
+
+	pack, err := server.repo.Getter.Get(info)
+
+	if err != nil {
+		return aptFile{}, err
+	}
+
+	file := aptFile{
+		Size:   int64(len(pack.Data)),
+		SHA256: hashData(pack.Data),
+	}
+
+	server.files[info.IpfsPath] = file
+	return file, nil
+}
+
+func recordedAptFile(info PackageInfo) (aptFile, bool) {
+	sum := info.GetMetaData(SHA256_KEY)
+	size, err := strconv.ParseInt(info.GetMetaData(SIZE_KEY), 10, 64)
+
+	if sum == "" || err != nil {
+		return aptFile{}, false
+	}
+
+	file := aptFile{
+		Size:   size,
+		SHA256: sum,
+	}
+
+	return file, true
+}
+
+func (repo AptRepository) poolPath(info PackageInfo) string {
+	prefix := info.Name[:1]
+	if strings.HasPrefix(info.Name, "lib") && len(info.Name) > 3 {
+		prefix = info.Name[:4]
+	}
+
+	return path.Join("pool", repo.Component, prefix, info.Name, normalizeHash(info.IpfsPath), aptFileName(info))
+}
+
+func (repo AptRepository) release(index *aptIndex, distPath string, indexFiles []string, archs []string) []byte {
+	buff := &bytes.Buffer{}
+
+	fmt.Fprintf(buff, "Origin: %s\n", repo.Origin)
+	fmt.Fprintf(buff, "Label: %s\n", repo.Origin)
+	fmt.Fprintf(buff, "Suite: %s\n", repo.Suite)
+	fmt.Fprintf(buff, "Codename: %s\n", repo.Suite)
+	fmt.Fprintf(buff, "Date: %s\n", index.built.Format(time.RFC1123))
+	fmt.Fprintf(buff, "Architectures: %s\n", strings.Join(archs, " "))
+	fmt.Fprintf(buff, "Components: %s\n", repo.Component)
+	fmt.Fprintf(buff, "Description: pkgthing packages for %s\n", repo.System)
+	fmt.Fprintf(buff, "SHA256:\n")
+
+	for _, name := range indexFiles {
+		data := index.files[path.Join(distPath, name)]
+		fmt.Fprintf(buff, " %s %d %s\n", hashData(data), len(data), name)
+	}
+
+	return buff.Bytes()
+}
+
+func (repo AptRepository) signRelease(index *aptIndex, distPath string, release []byte) error {
+	inRelease := &bytes.Buffer{}
+	writer, err := clearsign.Encode(inRelease, repo.SigningKey.PrivateKey, nil)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(release)
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+
+	if err != nil {
+		return err
+	}
+
+	detached := &bytes.Buffer{}
+	err = openpgp.ArmoredDetachSignText(detached, repo.SigningKey, bytes.NewReader(release), nil)
+
+	if err != nil {
+		return err
+	}
+
+	public := &bytes.Buffer{}
+	armored, err := armor.Encode(public, openpgp.PublicKeyType, nil)
+
+	if err != nil {
+		return err
+	}
+
+	err = repo.SigningKey.Serialize(armored)
+
+	if err != nil {
+		return err
+	}
+
+	err = armored.Close()
+
+	if err != nil {
+		return err
+	}
+
+	index.files[path.Join(distPath, "InRelease")] = inRelease.Bytes()
+	index.files[path.Join(distPath, "Release.gpg")] = detached.Bytes()
+	index.files[__APT_PUBLIC_KEY_FILE] = public.Bytes()
+	return nil
+}
+
+// aptPackages keeps one candidate per name, version and architecture.
+func aptPackages(found []PackageInfo) ([]PackageInfo, error) {
+	byKey := map[string][]PackageInfo{}
+	keys := []string{}
+
+	for _, info := range found {
+		if info.Name == "" || info.GetMetaData(VERSION_KEY) == "" || info.GetMetaData(ARCHITECTURE_KEY) == "" {
+			continue
+		}
+
+		key := aptFileName(info)
+		if _, present := byKey[key]; !present {
+			keys = append(keys, key)
+		}
+
+		byKey[key] = append(byKey[key], info)
+	}
+
+	sort.Strings(keys)
+
+	packages := make([]PackageInfo, 0, len(keys))
+	for _, key := range keys {
+		chosen, err := NewestPolicy{}.Choose(byKey[key])
+
+		if err != nil {
+			return nil, err
+		}
+
+		packages = append(packages, chosen)
+	}
+
+	return packages, nil
+}
+
+func aptStanza(info PackageInfo, poolPath string, file aptFile) string {
+	buff := &bytes.Buffer{}
+
+	fmt.Fprintf(buff, "Package: %s\n", info.Name)
+	fmt.Fprintf(buff, "Version: %s\n", info.GetMetaData(VERSION_KEY))
+	fmt.Fprintf(buff, "Architecture: %s\n", info.GetMetaData(ARCHITECTURE_KEY))
+
+	for _, field := range __APT_CONTROL_FIELDS {
+		value := info.GetMetaData(strings.ToLower(field))
+		if value != "" {
+			fmt.Fprintf(buff, "%s: %s\n", field, controlValue(value))
+		}
+	}
+
+	fmt.Fprintf(buff, "Filename: %s\n", poolPath)
+	fmt.Fprintf(buff, "Size: %d\n", file.Size)
+	fmt.Fprintf(buff, "SHA256: %s\n", file.SHA256)
+
+	return buff.String()
+}
+
+// controlValue indents continuation lines as deb822 requires.
+func controlValue(value string) string {
+	lines := strings.Split(strings.TrimRight(value, "\n"), "\n")
+
+	for i := 1; i < len(lines); i++ {
+		switch {
+		case strings.TrimSpace(lines[i]) == "":
+			lines[i] = " ."
+		case !strings.HasPrefix(lines[i], " "):
+			lines[i] = " " + lines[i]
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func aptFileName(info PackageInfo) string {
+	version := info.GetMetaData(VERSION_KEY)
+	if epoch := strings.Index(version, ":"); epoch >= 0 {
+		version = version[epoch+1:]
+	}
+
+	parts := []string{
+		info.Name,
+		version,
+		info.GetMetaData(ARCHITECTURE_KEY),
+	}
+
+	return strings.Join(parts, "_") + ".deb"
+}
+
+func gzipData(data []byte) ([]byte, error) {
+	buff := &bytes.Buffer{}
+	writer := gzip.NewWriter(buff)
+
+	_, err := writer.Write(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+var __APT_CONTROL_FIELDS = []string{
+	"Installed-Size",
+	"Maintainer",
+	"Section",
+	"Priority",
+	"Pre-Depends",
+	"Depends",
+	"Recommends",
+	"Suggests",
+	"Breaks",
+	"Conflicts",
+	"Replaces",
+	"Provides",
+	"Homepage",
+	"Description",
+}
+
+const __APT_ALL_ARCH = "all"
+const __APT_PUBLIC_KEY_FILE = "pubkey.gpg"
+const __PGP_PUBLIC_KEY_TAG = 6
+
+const __DEB_CONTENT_TYPE = "application/vnd.debian.binary-package"
+const __DEFAULT_APT_SUITE = "pkgthing"
+const __DEFAULT_APT_COMPONENT = "main"
+const __DEFAULT_APT_ORIGIN = "pkgthing"
+const __DEFAULT_APT_REFRESH = time.Minute
+
+var __APT_KEY_CREATED = time.Unix(0, 0).UTC()
+var __ED25519_OID = []byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01}
@@ -0,0 +1,217 @@
+package pkgthing
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+)
+
+// AptMirror lists and reads the packages of a local APT mirror, so that a
+// Syncer can publish them. Only packages listed by GetInstalledPackages can
+// be read with Get.
+type AptMirror struct {
+	Dir           string
+	Dist          string
+	System        string
+	Components    []string
+	Architectures []string
+
+	mutex   sync.Mutex
+	entries map[string]aptMirrorEntry
+}
+
+type aptMirrorEntry struct {
+	filename string
+	size     int64
+	sha256   string
+}
+
+func (mirror *AptMirror) GetInstalledPackages() ([]PackageInfo, error) {
+	const errMsg = "AptMirror.GetInstalledPackages failed"
+
+	indexes, err := mirror.findIndexes()
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("%s: No Packages indexes for '%s' in '%s'", errMsg, mirror.Dist, mirror.Dir)
+	}
+
+	entries := map[string]aptMirrorEntry{}
+	allInfo := []PackageInfo{}
+	for _, index := range indexes {
+		stanzas, err := readPackagesIndex(index)
+
+		if err != nil {
+			return nil, errors.Wrap(err, errMsg)
+		}
+
+		for _, stanza := range stanzas {
+			info, entry, err := mirror.readStanza(stanza)
+
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s: Bad entry in '%s'", errMsg, index)
+			}
+
+			key := aptFileName(info)
+			if _, present := entries[key]; present {
+				continue
+			}
+
+			entries[key] = entry
+			allInfo = append(allInfo, info)
+		}
+	}
+
+	mirror.mutex.Lock()
+	mirror.entries = entries
+	mirror.mutex.Unlock()
+
+	return allInfo, nil
+}
+
+func (mirror *AptMirror) Get(info PackageInfo) (Package, error) {
+	const errMsg = "AptMirror.Get failed"
+
+	mirror.mutex.Lock()
+	entry, ok := mirror.entries[aptFileName(info)]
+	mirror.mutex.Unlock()
+
+	if !ok {
+		return Package{}, fmt.Errorf("%s: Package '%s' is not in the mirror index", errMsg, info.Name)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(mirror.Dir, filepath.FromSlash(entry.filename)))
+
+	if err != nil {
+		return Package{}, errors.Wrap(err, errMsg)
+	}
+
+	if int64(len(data)) != entry.size {
+		return Package{}, fmt.Errorf("%s: Size of '%s' is %d, index says %d", errMsg, entry.filename, len(data), entry.size)
+	}
+
+	if sum := hashData(data); sum != entry.sha256 {
+		return Package{}, fmt.Errorf("%s: SHA256 of '%s' is %s, index says %s", errMsg, entry.filename, sum, entry.sha256)
+	}
+
+	pack := Package{
+		PackageInfo: info,
+		Data:        data,
+	}
+
+	return pack, nil
+}
+
+func (mirror *AptMirror) readStanza(stanza ControlStanza) (PackageInfo, aptMirrorEntry, error) {
+	entry := aptMirrorEntry{
+		filename: stanza.Get("Filename"),
+		sha256:   stanza.Get("SHA256"),
+	}
+
+	info := PackageInfo{
+		Name:   stanza.Get("Package"),
+		System: mirror.System,
+	}
+
+	if info.Name == "" || entry.filename == "" || entry.sha256 == "" {
+		return PackageInfo{}, aptMirrorEntry{}, fmt.Errorf("Missing Package, Filename or SHA256 for '%s'", info.Name)
+	}
+
+	size, err := strconv.ParseInt(stanza.Get("Size"), 10, 64)
+
+	if err != nil {
+		return PackageInfo{}, aptMirrorEntry{}, errors.Wrapf(err, "Bad Size for '%s'", info.Name)
+	}
+
+	entry.size = size
+	info = stanza.controlMetaData(info)
+
+	return info, entry, nil
+}
+
+// findIndexes returns one Packages index per component and architecture,
+// preferring the least compressed.
+func (mirror *AptMirror) findIndexes() ([]string, error) {
+	distDir := filepath.Join(mirror.Dir, "dists", mirror.Dist)
+	binaryDirs, err := filepath.Glob(filepath.Join(distDir, "*", "binary-*"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(binaryDirs)
+
+	indexes := []string{}
+	for _, dir := range binaryDirs {
+		component := filepath.Base(filepath.Dir(dir))
+		arch := filepath.Base(dir)[len("binary-"):]
+
+		if len(mirror.Components) > 0 && !containsString(mirror.Components, component) {
+			continue
+		}
+
+		if len(mirror.Architectures) > 0 && !containsString(mirror.Architectures, arch) {
+			continue
+		}
+
+		for _, name := range __APT_INDEX_NAMES {
+			index := filepath.Join(dir, name)
+
+			if _, err := os.Stat(index); err == nil {
+				indexes = append(indexes, index)
+				break
+			}
+		}
+	}
+
+	return indexes, nil
+}
+
+func readPackagesIndex(path string) ([]ControlStanza, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var reader io.Reader = file
+	switch filepath.Ext(path) {
+	case ".gz":
+		gzipReader, err := gzip.NewReader(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer gzipReader.Close()
+		reader = gzipReader
+	case ".xz":
+		reader, err = xz.NewReader(file)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ParseControl(reader)
+}
+
+var __APT_INDEX_NAMES = []string{
+	"Packages",
+	"Packages.gz",
+	"Packages.xz",
+}
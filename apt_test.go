@@ -0,0 +1,153 @@
+package pkgthing
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+func TestAptIndexUsesRecordedSums(t *testing.T) {
+	data := []byte("bash deb")
+
+	recorded := testPackageInfo("ubuntu", "bash", "4.4", "amd64").withDataSum(hashData(data), int64(len(data)))
+	recorded.IpfsPath = "bash-path"
+
+	unrecorded := testPackageInfo("ubuntu", "vim", "7.4", "amd64")
+	unrecorded.IpfsPath = "vim-path"
+
+	getter := &fakeGetter{data: map[string][]byte{"vim-path": []byte("vim deb")}}
+	repo := AptRepository{
+		Searcher: &fakeSearcher{found: []PackageInfo{recorded, unrecorded}},
+		Getter:   getter,
+		System:   "ubuntu",
+	}
+
+	handler := repo.Handler()
+	packages := testAptGet(t, handler, "/dists/pkgthing/main/binary-amd64/Packages")
+
+	if !strings.Contains(packages, "SHA256: "+hashData(data)) {
+		t.Errorf("Expected recorded sum in index:\n%s", packages)
+	}
+
+	if !strings.Contains(packages, "SHA256: "+hashData([]byte("vim deb"))) {
+		t.Errorf("Expected downloaded sum in index:\n%s", packages)
+	}
+
+	if getter.calls["bash-path"] != 0 {
+		t.Error("Expected package with a recorded sum not to be downloaded")
+	}
+
+	if getter.calls["vim-path"] != 1 {
+		t.Errorf("Expected package without a recorded sum to be downloaded once but was %d times", getter.calls["vim-path"])
+	}
+}
+
+func TestAptReleaseIsSigned(t *testing.T) {
+	key := testKey(t)
+	entity, err := MakeAptSigningKey(key, "pkgthing")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := MakeAptSigningKey(key, "pkgthing")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entity.PrimaryKey.KeyIdString() != again.PrimaryKey.KeyIdString() {
+		t.Error("Expected the same pkgthing key to give the same OpenPGP key")
+	}
+
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64").withDataSum(hashData([]byte("bash")), 4)
+	info.IpfsPath = "bash-path"
+
+	repo := AptRepository{
+		Searcher:   &fakeSearcher{found: []PackageInfo{info}},
+		Getter:     &fakeGetter{},
+		System:     "ubuntu",
+		SigningKey: entity,
+	}
+
+	handler := repo.Handler()
+	release := testAptGet(t, handler, "/dists/pkgthing/Release")
+	signature := testAptGet(t, handler, "/dists/pkgthing/Release.gpg")
+	inRelease := testAptGet(t, handler, "/dists/pkgthing/InRelease")
+
+	// Check against the served public key, as apt would.
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(testAptGet(t, handler, "/pubkey.gpg")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = openpgp.CheckArmoredDetachedSignature(keyring, strings.NewReader(release), strings.NewReader(signature), nil)
+
+	if err != nil {
+		t.Errorf("Expected Release signature to verify: %v", err)
+	}
+
+	block, _ := clearsign.Decode([]byte(inRelease))
+
+	if block == nil {
+		t.Fatal("Expected InRelease to be clearsigned")
+	}
+
+	_, err = block.VerifySignature(keyring, nil)
+
+	if err != nil {
+		t.Errorf("Expected InRelease signature to verify: %v", err)
+	}
+}
+
+func testAptGet(t *testing.T, handler http.Handler, path string) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected %s to be found but got %d", path, recorder.Code)
+	}
+
+	body, err := ioutil.ReadAll(recorder.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+// fakeGetter serves data by IpfsPath and counts downloads.
+type fakeGetter struct {
+	sync.Mutex
+	data  map[string][]byte
+	calls map[string]int
+}
+
+func (getter *fakeGetter) Get(info PackageInfo) (Package, error) {
+	getter.Lock()
+	defer getter.Unlock()
+
+	if getter.calls == nil {
+		getter.calls = map[string]int{}
+	}
+
+	getter.calls[info.IpfsPath]++
+
+	pack := Package{
+		PackageInfo: info,
+		Data:        bytes.Clone(getter.data[info.IpfsPath]),
+	}
+
+	return pack, nil
+}
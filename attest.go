@@ -0,0 +1,128 @@
+package pkgthing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Attestation is a signed claim about a published blob, such as having
+// rebuilt it from source and got the same hash.
+type Attestation struct {
+	IpfsPath  string
+	Claim     string
+	Time      time.Time
+	Signature Signature
+}
+
+func (attestation Attestation) payload(info PackageInfo) []byte {
+	text := fmt.Sprintf("attest\n%s\n%s\n%s\n%s\n%s", info.System, info.Name, attestation.IpfsPath, attestation.Claim, attestation.Time.UTC().Format(time.RFC3339Nano))
+	return []byte(text)
+}
+
+func (attestation Attestation) isValid(info PackageInfo) bool {
+	return attestation.Signature.Verify(attestation.payload(info))
+}
+
+func (thing *pkgthing) Attest(info PackageInfo, claim string) error {
+	const failMsg = "Attest failed"
+
+	if thing.Signer == nil {
+		return errors.New(failMsg + ": no signing key")
+	}
+
+	info, err := thing.resolvePath(info)
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	attestation := Attestation{
+		IpfsPath: info.IpfsPath,
+		Claim:    claim,
+		Time:     time.Now().UTC(),
+	}
+
+	attestation.Signature, err = thing.Signer.Sign(attestation.payload(info))
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	err = thing.addRecord(info, __ATTESTATION_KEY, attestation)
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	return nil
+}
+
+// AttestationPolicy requires Required attestations of Claim from distinct
+// Keys other than the publisher's. Anyone can generate a key, so
+// attestations from other keys never count.
+type AttestationPolicy struct {
+	Required int
+	Claim    string
+	Keys     []KeyReference
+}
+
+func (policy AttestationPolicy) Check(info PackageInfo) error {
+	if len(policy.Keys) == 0 {
+		return errors.New("No keys may attest")
+	}
+
+	attesters := map[string]bool{}
+
+	for _, attestation := range info.Attestations {
+		if policy.Claim != "" && attestation.Claim != policy.Claim {
+			continue
+		}
+
+		key := attestation.Signature.Fingerprint
+
+		if info.IsSignedBy(key) {
+			continue
+		}
+
+		if !containsKey(policy.Keys, key) {
+			continue
+		}
+
+		attesters[key.String()] = true
+	}
+
+	if len(attesters) < policy.Required {
+		return fmt.Errorf("Package '%s' on '%s' has %d of %d required attestations", info.Name, info.System, len(attesters), policy.Required)
+	}
+
+	return nil
+}
+
+// CheckAll passes only if every checker passes.
+type CheckAll []SignatureChecker
+
+func (checkers CheckAll) Check(info PackageInfo) error {
+	for _, checker := range checkers {
+		err := checker.Check(info)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func containsKey(keys []KeyReference, key KeyReference) bool {
+	for _, k := range keys {
+		if k.Type == key.Type && k.String() == key.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+const REPRODUCIBLE_BUILD_CLAIM = "reproducible-build"
@@ -0,0 +1,57 @@
+package pkgthing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAttestationPolicy(t *testing.T) {
+	publisher := testKey(t)
+	attester := testKey(t)
+	stranger := testKey(t)
+
+	info := testPublish(t, testPackageInfo("ubuntu", "bash", "4.4", "amd64"), publisher)
+	info.IpfsPath = "bash-path"
+
+	for _, signer := range []Ed25519Key{publisher, attester, stranger} {
+		info.Attestations = append(info.Attestations, testAttest(t, info, signer))
+	}
+
+	policy := AttestationPolicy{Required: 1, Claim: REPRODUCIBLE_BUILD_CLAIM}
+
+	if policy.Check(info) == nil {
+		t.Error("Expected a policy without keys to count no attestations")
+	}
+
+	policy.Keys = []KeyReference{publisher.Reference(), stranger.Reference()}
+	policy.Required = 2
+
+	if policy.Check(info) == nil {
+		t.Error("Expected the publisher's own attestation not to count")
+	}
+
+	policy.Keys = []KeyReference{attester.Reference(), stranger.Reference()}
+
+	if err := policy.Check(info); err != nil {
+		t.Errorf("Expected two attestations from listed keys to pass: %v", err)
+	}
+}
+
+func testAttest(t *testing.T, info PackageInfo, signer Signer) Attestation {
+	t.Helper()
+
+	attestation := Attestation{
+		IpfsPath: info.IpfsPath,
+		Claim:    REPRODUCIBLE_BUILD_CLAIM,
+		Time:     time.Now().UTC(),
+	}
+
+	sig, err := signer.Sign(attestation.payload(info))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestation.Signature = sig
+	return attestation
+}
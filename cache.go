@@ -0,0 +1,553 @@
+package pkgthing
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type CacheOptions struct {
+	Dir     string
+	MaxSize int64
+	Logger  Logger
+}
+
+// MakeCachingStorage keeps blobs from store on local disk, evicting the least
+// recently used when the cache grows beyond MaxSize bytes.
+func MakeCachingStorage(store ContentAddressableStorage, options CacheOptions) (ContentAddressableStorage, error) {
+	const errMsg = "MakeCachingStorage failed"
+
+	if options.Dir == "" {
+		return nil, errors.New("Cache directory was empty")
+	}
+
+	if options.MaxSize <= 0 {
+		options.MaxSize = __DEFAULT_CACHE_SIZE
+	}
+
+	options.Logger = useLogger(options.Logger)
+
+	err := os.MkdirAll(options.Dir, __CACHE_DIR_MODE)
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	cache := &cachingStorage{
+		store:   store,
+		options: options,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+
+	err = cache.loadEntries()
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	return cache, nil
+}
+
+type cachingStorage struct {
+	sync.Mutex
+	store   ContentAddressableStorage
+	options CacheOptions
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+}
+
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// Cat streams a cached blob from disk, checking it against its recorded sum
+// as it is read. Other blobs are streamed from the store, and cached once
+// read to the end.
+func (cache *cachingStorage) Cat(hash string) (io.ReadCloser, error) {
+	if cached, ok := cache.open(hash); ok {
+		return cached, nil
+	}
+
+	stored, err := cache.store.Cat(hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	writer := cache.makeCacheWriter()
+	reader := &cachingReader{
+		Reader: io.TeeReader(stored, writer),
+		stored: stored,
+		writer: writer,
+		hash:   hash,
+	}
+
+	return reader, nil
+}
+
+// Add streams r to the store, caching it on the way.
+func (cache *cachingStorage) Add(r io.Reader) (string, error) {
+	writer := cache.makeCacheWriter()
+	hash, err := cache.store.Add(io.TeeReader(r, writer))
+
+	if err != nil {
+		writer.discard()
+		return "", err
+	}
+
+	writer.commit(hash)
+
+	return hash, nil
+}
+
+func (cache *cachingStorage) Has(hash string) bool {
+	cache.Lock()
+	defer cache.Unlock()
+
+	_, ok := cache.entries[cacheKey(hash)]
+	return ok
+}
+
+// Pin, Unpin and Pins pass through to the cached store, if it pins.
+func (cache *cachingStorage) Pin(hash string) error {
+	store, err := cache.pinningStore()
+
+	if err != nil {
+		return err
+	}
+
+	return store.Pin(hash)
+}
+
+func (cache *cachingStorage) Unpin(hash string) error {
+	store, err := cache.pinningStore()
+
+	if err != nil {
+		return err
+	}
+
+	return store.Unpin(hash)
+}
+
+func (cache *cachingStorage) Pins() ([]string, error) {
+	store, err := cache.pinningStore()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Pins()
+}
+
+func (cache *cachingStorage) pinningStore() (PinningStorage, error) {
+	store, ok := cache.store.(PinningStorage)
+
+	if !ok {
+		return nil, errors.New("Cached storage does not pin")
+	}
+
+	return store, nil
+}
+
+func (cache *cachingStorage) open(hash string) (io.ReadCloser, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	key := cacheKey(hash)
+	element, ok := cache.entries[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	sum, err := ioutil.ReadFile(cache.sumPath(key))
+
+	var file *os.File
+	if err == nil {
+		file, err = os.Open(cache.blobPath(key))
+	}
+
+	if err != nil {
+		cache.options.Logger.Log(LOG_WARN, "Evicting bad cache entry", LogField{Key: "hash", Value: hash}, errorField(err))
+		cache.evict(element)
+		return nil, false
+	}
+
+	cache.lru.MoveToFront(element)
+
+	now := time.Now()
+	err = os.Chtimes(cache.blobPath(key), now, now)
+
+	if err != nil {
+		cache.options.Logger.Log(LOG_WARN, "Failed to touch cache entry", LogField{Key: "hash", Value: hash}, errorField(err))
+	}
+
+	reader := &verifyingReader{
+		file:     file,
+		cache:    cache,
+		hash:     hash,
+		expected: string(sum),
+		sum:      sha256.New(),
+	}
+
+	return reader, true
+}
+
+// discard evicts the entry for hash, if it is still cached.
+func (cache *cachingStorage) discard(hash string) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if element, ok := cache.entries[cacheKey(hash)]; ok {
+		cache.evict(element)
+	}
+}
+
+// keep moves a fully written temporary file into the cache as hash.
+func (cache *cachingStorage) keep(hash, path, sum string, size int64) error {
+	cache.Lock()
+	defer cache.Unlock()
+
+	key := cacheKey(hash)
+
+	if _, ok := cache.entries[key]; ok {
+		return nil
+	}
+
+	// Write the sum first, so that every blob in the cache has one.
+	err := writeFileAtomic(cache.sumPath(key), []byte(sum))
+
+	if err == nil {
+		err = os.Rename(path, cache.blobPath(key))
+	}
+
+	if err != nil {
+		cache.removeFiles(key)
+		return err
+	}
+
+	cache.insert(cacheEntry{key: key, size: size})
+
+	return nil
+}
+
+// verifyingReader reads a cached blob, failing at the end if it does not match
+// its recorded sum.
+type verifyingReader struct {
+	file     *os.File
+	cache    *cachingStorage
+	hash     string
+	expected string
+	sum      hash.Hash
+}
+
+func (reader *verifyingReader) Read(p []byte) (int, error) {
+	n, err := reader.file.Read(p)
+	reader.sum.Write(p[:n])
+
+	if err == io.EOF && hex.EncodeToString(reader.sum.Sum(nil)) != reader.expected {
+		reader.cache.options.Logger.Log(LOG_WARN, "Evicting bad cache entry", LogField{Key: "hash", Value: reader.hash})
+		reader.cache.discard(reader.hash)
+		return n, fmt.Errorf("Checksum mismatch for cached blob '%s'", reader.hash)
+	}
+
+	return n, err
+}
+
+func (reader *verifyingReader) Close() error {
+	return reader.file.Close()
+}
+
+// cachingReader streams a blob from the store, caching it once it has been
+// read to the end.
+type cachingReader struct {
+	io.Reader
+	stored io.ReadCloser
+	writer *cacheWriter
+	hash   string
+}
+
+func (reader *cachingReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+
+	if err == io.EOF {
+		reader.writer.commit(reader.hash)
+	}
+
+	return n, err
+}
+
+func (reader *cachingReader) Close() error {
+	reader.writer.discard()
+	return reader.stored.Close()
+}
+
+// cacheWriter copies a blob into a temporary file in the cache as it streams
+// past, so that blobs are cached without being held in memory. Blobs larger
+// than the cache are not kept.
+type cacheWriter struct {
+	cache    *cachingStorage
+	temp     *os.File
+	sum      hash.Hash
+	size     int64
+	tooLarge bool
+	err      error
+}
+
+func (cache *cachingStorage) makeCacheWriter() *cacheWriter {
+	temp, err := ioutil.TempFile(cache.options.Dir, __TEMP_PREFIX)
+
+	if err != nil {
+		cache.options.Logger.Log(LOG_WARN, "Failed to cache blob", errorField(err))
+	}
+
+	writer := &cacheWriter{
+		cache: cache,
+		temp:  temp,
+		sum:   sha256.New(),
+	}
+
+	return writer
+}
+
+// Write never fails, so that failing to cache does not fail the transfer.
+func (writer *cacheWriter) Write(p []byte) (int, error) {
+	if writer.temp == nil || writer.tooLarge || writer.err != nil {
+		return len(p), nil
+	}
+
+	writer.size += int64(len(p))
+
+	if writer.size > writer.cache.options.MaxSize {
+		writer.tooLarge = true
+		return len(p), nil
+	}
+
+	writer.sum.Write(p)
+	_, writer.err = writer.temp.Write(p)
+
+	return len(p), nil
+}
+
+// commit caches what was written as hash.
+func (writer *cacheWriter) commit(hash string) {
+	if writer.temp == nil || writer.tooLarge {
+		writer.discard()
+		return
+	}
+
+	err := writer.err
+
+	if err == nil {
+		err = writer.temp.Close()
+	}
+
+	if err == nil {
+		err = writer.cache.keep(hash, writer.temp.Name(), hex.EncodeToString(writer.sum.Sum(nil)), writer.size)
+	}
+
+	if err != nil {
+		writer.cache.options.Logger.Log(LOG_WARN, "Failed to cache blob", LogField{Key: "hash", Value: hash}, errorField(err))
+	}
+
+	writer.discard()
+}
+
+// discard removes the temporary file, unless it was kept.
+func (writer *cacheWriter) discard() {
+	if writer.temp == nil {
+		return
+	}
+
+	writer.temp.Close()
+
+	err := os.Remove(writer.temp.Name())
+
+	if err != nil && !os.IsNotExist(err) {
+		writer.cache.options.Logger.Log(LOG_WARN, "Failed to remove cache file", LogField{Key: "path", Value: writer.temp.Name()}, errorField(err))
+	}
+
+	writer.temp = nil
+}
+
+func (cache *cachingStorage) insert(entry cacheEntry) {
+	cache.entries[entry.key] = cache.lru.PushFront(entry)
+	cache.size += entry.size
+
+	for cache.size > cache.options.MaxSize {
+		cache.evict(cache.lru.Back())
+	}
+}
+
+func (cache *cachingStorage) evict(element *list.Element) {
+	entry := cache.lru.Remove(element).(cacheEntry)
+	delete(cache.entries, entry.key)
+	cache.size -= entry.size
+	cache.removeFiles(entry.key)
+}
+
+func (cache *cachingStorage) removeFiles(key string) {
+	for _, path := range []string{cache.blobPath(key), cache.sumPath(key)} {
+		err := os.Remove(path)
+
+		if err != nil && !os.IsNotExist(err) {
+			cache.options.Logger.Log(LOG_WARN, "Failed to remove cache file", LogField{Key: "path", Value: path}, errorField(err))
+		}
+	}
+}
+
+func (cache *cachingStorage) loadEntries() error {
+	files, err := ioutil.ReadDir(cache.options.Dir)
+
+	if err != nil {
+		return err
+	}
+
+	blobs := []os.FileInfo{}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), __CACHE_BLOB_EXT) {
+			blobs = append(blobs, f)
+		}
+	}
+
+	// Oldest first so that the most recently used ends up at the front.
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].ModTime().Before(blobs[j].ModTime())
+	})
+
+	for _, f := range blobs {
+		entry := cacheEntry{
+			key:  strings.TrimSuffix(f.Name(), __CACHE_BLOB_EXT),
+			size: f.Size(),
+		}
+		cache.insert(entry)
+	}
+
+	return nil
+}
+
+func (cache *cachingStorage) blobPath(key string) string {
+	return filepath.Join(cache.options.Dir, key+__CACHE_BLOB_EXT)
+}
+
+func (cache *cachingStorage) sumPath(key string) string {
+	return filepath.Join(cache.options.Dir, key+__CACHE_SUM_EXT)
+}
+
+func cacheKey(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), __TEMP_PREFIX)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = temp.Write(data)
+
+	if err == nil {
+		err = temp.Close()
+	} else {
+		temp.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	return nil
+}
+
+type searchCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	results map[string]searchResult
+}
+
+type searchResult struct {
+	expires time.Time
+	info    []PackageInfo
+}
+
+func makeSearchCache(ttl time.Duration) *searchCache {
+	return &searchCache{
+		ttl:     ttl,
+		results: map[string]searchResult{},
+	}
+}
+
+func (cache *searchCache) get(term PackageSearchTerm) ([]PackageInfo, bool) {
+	if cache.ttl <= 0 {
+		return nil, false
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	key := searchCacheKey(term)
+	result, ok := cache.results[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(result.expires) {
+		delete(cache.results, key)
+		return nil, false
+	}
+
+	return result.info, true
+}
+
+func (cache *searchCache) put(term PackageSearchTerm, info []PackageInfo) {
+	if cache.ttl <= 0 {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.results[searchCacheKey(term)] = searchResult{
+		expires: time.Now().Add(cache.ttl),
+		info:    info,
+	}
+}
+
+func (cache *searchCache) invalidate() {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.results = map[string]searchResult{}
+}
+
+func searchCacheKey(term PackageSearchTerm) string {
+	return fmt.Sprintf("%v", term)
+}
+
+const __DEFAULT_CACHE_SIZE = 1 << 30
+const __CACHE_DIR_MODE = 0755
+const __CACHE_BLOB_EXT = ".blob"
+const __CACHE_SUM_EXT = ".sha256"
@@ -0,0 +1,154 @@
+package pkgthing
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCachingStorageStreamsThroughCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkgthing-cache")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	store := makeMemoryStorage()
+	cache := testCachingStorage(t, store, dir, 1024)
+
+	small := testRandomData(1, 512)
+	large := testRandomData(2, 2048)
+
+	smallHash, err := cache.Add(bytes.NewReader(small))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	largeHash, err := cache.Add(bytes.NewReader(large))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cache.Has(smallHash) {
+		t.Error("Expected an added blob to be cached")
+	}
+
+	if cache.Has(largeHash) {
+		t.Error("Expected a blob larger than the cache not to be cached")
+	}
+
+	// A cached blob is read without the store.
+	delete(store.blobs, smallHash)
+	assertCat(t, cache, smallHash, small)
+
+	// A partly read blob is not cached.
+	other := testRandomData(3, 512)
+	otherHash, err := store.Add(bytes.NewReader(other))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := cache.Cat(otherHash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader.Read(make([]byte, 10))
+	reader.Close()
+
+	if cache.Has(otherHash) {
+		t.Error("Expected a partly read blob not to be cached")
+	}
+
+	assertCat(t, cache, otherHash, other)
+
+	if !cache.Has(otherHash) {
+		t.Error("Expected a fully read blob to be cached")
+	}
+}
+
+func TestCachingStorageEvictsBadEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkgthing-cache")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	store := makeMemoryStorage()
+	cache := testCachingStorage(t, store, dir, 1024)
+
+	data := testRandomData(1, 512)
+	hash, err := cache.Add(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(cache.blobPath(cacheKey(hash)), []byte("corrupt"), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := cache.Cat(hash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ioutil.ReadAll(reader)
+	reader.Close()
+
+	if err == nil {
+		t.Error("Expected reading a corrupt cache entry to fail")
+	}
+
+	if cache.Has(hash) {
+		t.Error("Expected the corrupt entry to be evicted")
+	}
+
+	assertCat(t, cache, hash, data)
+}
+
+func testCachingStorage(t *testing.T, store ContentAddressableStorage, dir string, size int64) *cachingStorage {
+	t.Helper()
+
+	cache, err := MakeCachingStorage(store, CacheOptions{Dir: dir, MaxSize: size})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cache.(*cachingStorage)
+}
+
+func assertCat(t *testing.T, store ContentAddressableStorage, hash string, expected []byte) {
+	t.Helper()
+
+	reader, err := store.Cat(hash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	actual, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("Blob '%s' did not match", hash)
+	}
+}
@@ -8,3 +8,14 @@ type ContentAddressableStorage interface {
 	Add(data io.Reader) (string, error)
 	Cat(hash string) (io.ReadCloser, error)
 }
+
+type LocalStorage interface {
+	Has(hash string) bool
+}
+
+type PinningStorage interface {
+	ContentAddressableStorage
+	Pin(hash string) error
+	Unpin(hash string) error
+	Pins() ([]string, error)
+}
@@ -0,0 +1,97 @@
+package pkgthing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// memoryStorage is a PinningStorage kept in memory, for tests.
+type memoryStorage struct {
+	sync.Mutex
+	blobs map[string][]byte
+	pins  map[string]bool
+	adds  int
+}
+
+func makeMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		blobs: map[string][]byte{},
+		pins:  map[string]bool{},
+	}
+}
+
+func (store *memoryStorage) Add(r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	hash := "mem-" + hashData(data)
+	store.blobs[hash] = data
+	store.pins[hash] = true
+	store.adds++
+
+	return hash, nil
+}
+
+func (store *memoryStorage) Cat(hash string) (io.ReadCloser, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	data, ok := store.blobs[hash]
+
+	if !ok {
+		return nil, fmt.Errorf("No blob '%s'", hash)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (store *memoryStorage) Pin(hash string) error {
+	store.Lock()
+	defer store.Unlock()
+
+	if _, ok := store.blobs[hash]; !ok {
+		return fmt.Errorf("No blob '%s'", hash)
+	}
+
+	store.pins[hash] = true
+	return nil
+}
+
+func (store *memoryStorage) Unpin(hash string) error {
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.pins, hash)
+	return nil
+}
+
+func (store *memoryStorage) Pins() ([]string, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	hashes := []string{}
+	for hash := range store.pins {
+		hashes = append(hashes, hash)
+	}
+
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+func (store *memoryStorage) has(hash string) bool {
+	store.Lock()
+	defer store.Unlock()
+
+	_, ok := store.blobs[hash]
+	return ok
+}
@@ -0,0 +1,158 @@
+package pkgthing
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Promotion moves a published blob into a channel, such as "stable". A
+// package starts in the channel given by its CHANNEL_KEY metadata, if any,
+// and is in the channel of its latest promotion after that.
+type Promotion struct {
+	IpfsPath  string
+	From      string
+	To        string
+	Approver  string
+	Time      time.Time
+	Signature Signature
+}
+
+func (promotion Promotion) payload(info PackageInfo) []byte {
+	text := fmt.Sprintf("promote\n%s\n%s\n%s\n%s\n%s\n%s\n%s", info.System, info.Name, promotion.IpfsPath, promotion.From, promotion.To, promotion.Approver, promotion.Time.UTC().Format(time.RFC3339Nano))
+	return []byte(text)
+}
+
+func (promotion Promotion) isValid(info PackageInfo) bool {
+	return promotion.Signature.Verify(promotion.payload(info))
+}
+
+// Channel returns the channel of the package. Only promotions signed by one of
+// the promoters count, so with no promoters it is the published channel.
+func (info PackageInfo) Channel(promoters []KeyReference) string {
+	channel := info.GetMetaData(CHANNEL_KEY)
+
+	for _, promotion := range info.Promotions {
+		if !containsKey(promoters, promotion.Signature.Fingerprint) {
+			continue
+		}
+
+		channel = promotion.To
+	}
+
+	return channel
+}
+
+func (thing *pkgthing) Promote(info PackageInfo, from, to, approver string) error {
+	const failMsg = "Promote failed"
+
+	if thing.Signer == nil {
+		return errors.New(failMsg + ": no signing key")
+	}
+
+	if to == "" {
+		return errors.New(failMsg + ": no channel")
+	}
+
+	if !containsKey(thing.Promoters, thing.Signer.Reference()) {
+		return fmt.Errorf("%s: Key '%s' may not promote", failMsg, thing.Signer.Reference())
+	}
+
+	found, err := thing.findVersion(info)
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	if current := found.Channel(thing.Promoters); from != "" && current != from {
+		return fmt.Errorf("%s: Package '%s' at '%s' is in channel '%s', not '%s'", failMsg, found.Name, found.IpfsPath, current, from)
+	}
+
+	promotion := Promotion{
+		IpfsPath: found.IpfsPath,
+		From:     found.Channel(thing.Promoters),
+		To:       to,
+		Approver: approver,
+		Time:     time.Now().UTC(),
+	}
+
+	promotion.Signature, err = thing.Signer.Sign(promotion.payload(found))
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	err = thing.addRecord(found, __PROMOTION_KEY, promotion)
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	return nil
+}
+
+// findVersion finds the indexed candidate with the IpfsPath of info or, failing
+// that, its VERSION_KEY metadata, ignoring the channel.
+func (thing *pkgthing) findVersion(info PackageInfo) (PackageInfo, error) {
+	candidates, err := thing.findCandidates(info)
+
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	version := info.GetMetaData(VERSION_KEY)
+	matching := []PackageInfo{}
+	for _, candidate := range candidates {
+		switch {
+		case info.IpfsPath != "":
+			if candidate.IpfsPath != info.IpfsPath {
+				continue
+			}
+		case version != "":
+			if !candidate.HasMetaData(VERSION_KEY, version) {
+				continue
+			}
+		}
+
+		if !thing.IncludeYanked && candidate.IsYanked() {
+			continue
+		}
+
+		matching = append(matching, candidate)
+	}
+
+	if len(matching) == 0 {
+		return PackageInfo{}, fmt.Errorf("Package '%s' not found on '%s'", info.Name, info.System)
+	}
+
+	return thing.ConflictPolicy.Choose(matching)
+}
+
+func inChannel(allInfo []PackageInfo, channel string, promoters []KeyReference) []PackageInfo {
+	found := make([]PackageInfo, 0, len(allInfo))
+
+	for _, info := range allInfo {
+		if info.Channel(promoters) == channel {
+			found = append(found, info)
+		}
+	}
+
+	return found
+}
+
+// applyPromotions gives info its valid promotions in time order.
+func applyPromotions(info *PackageInfo, promotions []Promotion) {
+	for _, promotion := range promotions {
+		if promotion.IpfsPath == info.IpfsPath && promotion.isValid(*info) {
+			info.Promotions = append(info.Promotions, promotion)
+		}
+	}
+
+	sort.SliceStable(info.Promotions, func(i, j int) bool {
+		return info.Promotions[i].Time.Before(info.Promotions[j].Time)
+	})
+}
+
+const CHANNEL_KEY = "channel"
@@ -0,0 +1,58 @@
+package pkgthing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChannelCountsOnlyPromoters(t *testing.T) {
+	promoter := testKey(t)
+	stranger := testKey(t)
+
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	info.IpfsPath = "bash-path"
+	info.MetaData = append(info.MetaData, MetaDataEntry{MetaDataKey: CHANNEL_KEY, MetaDataValue: "testing"})
+
+	start := time.Now().UTC()
+	applyPromotions(&info, []Promotion{
+		testPromotion(t, info, "stable", start, promoter),
+		testPromotion(t, info, "rogue", start.Add(time.Second), stranger),
+	})
+
+	if len(info.Promotions) != 2 {
+		t.Fatalf("Expected 2 valid promotions but got %d", len(info.Promotions))
+	}
+
+	if channel := info.Channel(nil); channel != "testing" {
+		t.Errorf("Expected no promoters to leave the published channel but got '%s'", channel)
+	}
+
+	if channel := info.Channel([]KeyReference{promoter.Reference()}); channel != "stable" {
+		t.Errorf("Expected the promoter's channel but got '%s'", channel)
+	}
+}
+
+func TestPromoteRejectsUnlistedSigner(t *testing.T) {
+	key := testKey(t)
+
+	thing := &pkgthing{Options: Options{Signer: key}}
+	err := thing.Promote(testPackageInfo("ubuntu", "bash", "4.4", "amd64"), "", "stable", "me")
+
+	if err == nil {
+		t.Error("Expected a promotion by an unlisted key to fail")
+	}
+}
+
+func testPromotion(t *testing.T, info PackageInfo, to string, at time.Time, signer Signer) Promotion {
+	t.Helper()
+
+	promotion := Promotion{IpfsPath: info.IpfsPath, To: to, Time: at}
+	sig, err := signer.Sign(promotion.payload(info))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	promotion.Signature = sig
+	return promotion
+}
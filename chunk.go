@@ -0,0 +1,403 @@
+package pkgthing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ChunkOptions control how large packages are split. Packages larger than
+// Threshold bytes are stored as content-defined chunks listed in a manifest
+// object. Dir records chunks already transferred so that interrupted
+// transfers can resume, and so that unchanged chunks are not uploaded twice.
+type ChunkOptions struct {
+	Threshold int
+	Dir       string
+}
+
+type chunkManifest struct {
+	Size   int64
+	Sum    string
+	Chunks []chunkRef
+}
+
+type chunkRef struct {
+	Hash string
+	Sum  string
+	Size int
+}
+
+type chunkStore struct {
+	store   ContentAddressableStorage
+	options ChunkOptions
+	logger  Logger
+}
+
+func (chunks chunkStore) shouldChunk(data []byte) bool {
+	return chunks.options.Threshold > 0 && len(data) > chunks.options.Threshold
+}
+
+func isChunked(info PackageInfo) bool {
+	return info.GetMetaData(STORAGE_KEY) == CHUNKED_STORAGE
+}
+
+func (chunks chunkStore) add(data []byte) (string, error) {
+	const errMsg = "Chunked add failed"
+
+	manifest := chunkManifest{
+		Size: int64(len(data)),
+		Sum:  hashData(data),
+	}
+
+	for _, chunk := range splitChunks(data) {
+		ref, err := chunks.addChunk(chunk)
+
+		if err != nil {
+			return "", errors.Wrap(err, errMsg)
+		}
+
+		manifest.Chunks = append(manifest.Chunks, ref)
+	}
+
+	encoded, err := json.Marshal(manifest)
+
+	if err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	hash, err := chunks.store.Add(bytes.NewReader(encoded))
+
+	if err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	return hash, nil
+}
+
+func (chunks chunkStore) addChunk(chunk []byte) (chunkRef, error) {
+	ref := chunkRef{
+		Sum:  hashData(chunk),
+		Size: len(chunk),
+	}
+
+	// A known chunk need only be pinned, so that this store keeps it too.
+	if hash, ok := chunks.knownHash(ref.Sum); ok && chunks.pin(hash) {
+		ref.Hash = hash
+		return ref, nil
+	}
+
+	hash, err := chunks.store.Add(bytes.NewReader(chunk))
+
+	if err != nil {
+		return chunkRef{}, err
+	}
+
+	ref.Hash = hash
+	chunks.rememberHash(ref.Sum, hash)
+
+	return ref, nil
+}
+
+func (chunks chunkStore) pin(hash string) bool {
+	store, ok := chunks.store.(PinningStorage)
+	return ok && store.Pin(hash) == nil
+}
+
+func (chunks chunkStore) cat(path string) ([]byte, error) {
+	const errMsg = "Chunked cat failed"
+
+	manifest, err := chunks.readManifest(path)
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	buff := &bytes.Buffer{}
+
+	for _, ref := range manifest.Chunks {
+		chunk, err := chunks.catChunk(ref)
+
+		if err != nil {
+			return nil, errors.Wrap(err, errMsg)
+		}
+
+		buff.Write(chunk)
+	}
+
+	data := buff.Bytes()
+
+	if hashData(data) != manifest.Sum {
+		return nil, fmt.Errorf("%s: checksum mismatch for '%s'", errMsg, path)
+	}
+
+	for _, ref := range manifest.Chunks {
+		chunks.forgetChunk(ref.Sum)
+	}
+
+	return data, nil
+}
+
+// open streams the chunks of path one at a time, checking the whole against
+// the manifest once the last chunk is read.
+func (chunks chunkStore) open(path string) (io.ReadCloser, error) {
+	manifest, err := chunks.readManifest(path)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Chunked open failed")
+	}
+
+	reader := &chunkReader{
+		chunks:   chunks,
+		manifest: manifest,
+		path:     path,
+		sum:      sha256.New(),
+	}
+
+	return reader, nil
+}
+
+type chunkReader struct {
+	chunks   chunkStore
+	manifest chunkManifest
+	path     string
+	next     int
+	current  []byte
+	sum      hash.Hash
+}
+
+func (reader *chunkReader) Read(p []byte) (int, error) {
+	for len(reader.current) == 0 {
+		if reader.next == len(reader.manifest.Chunks) {
+			return 0, reader.finish()
+		}
+
+		chunk, err := reader.chunks.catChunk(reader.manifest.Chunks[reader.next])
+
+		if err != nil {
+			return 0, errors.Wrap(err, "Chunked read failed")
+		}
+
+		reader.next++
+		reader.sum.Write(chunk)
+		reader.current = chunk
+	}
+
+	n := copy(p, reader.current)
+	reader.current = reader.current[n:]
+	return n, nil
+}
+
+func (reader *chunkReader) finish() error {
+	if hex.EncodeToString(reader.sum.Sum(nil)) != reader.manifest.Sum {
+		return fmt.Errorf("Chunked read failed: checksum mismatch for '%s'", reader.path)
+	}
+
+	for _, ref := range reader.manifest.Chunks {
+		reader.chunks.forgetChunk(ref.Sum)
+	}
+
+	return io.EOF
+}
+
+func (reader *chunkReader) Close() error {
+	return nil
+}
+
+func (chunks chunkStore) readManifest(path string) (chunkManifest, error) {
+	reader, err := chunks.store.Cat(path)
+
+	if err != nil {
+		return chunkManifest{}, err
+	}
+
+	defer reader.Close()
+
+	manifest := chunkManifest{}
+	err = json.NewDecoder(reader).Decode(&manifest)
+	return manifest, err
+}
+
+func (chunks chunkStore) catChunk(ref chunkRef) ([]byte, error) {
+	if data, ok := chunks.localChunk(ref.Sum); ok {
+		return data, nil
+	}
+
+	reader, err := chunks.store.Cat(ref.Hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if hashData(data) != ref.Sum {
+		return nil, fmt.Errorf("Checksum mismatch for chunk '%s'", ref.Hash)
+	}
+
+	chunks.saveChunk(ref.Sum, data)
+	chunks.rememberHash(ref.Sum, ref.Hash)
+
+	return data, nil
+}
+
+func (chunks chunkStore) knownHash(sum string) (string, bool) {
+	if chunks.options.Dir == "" {
+		return "", false
+	}
+
+	hash, err := ioutil.ReadFile(chunks.path(sum, __CHUNK_HASH_EXT))
+
+	if err != nil {
+		return "", false
+	}
+
+	return string(hash), true
+}
+
+func (chunks chunkStore) rememberHash(sum, hash string) {
+	chunks.writeLocal(chunks.path(sum, __CHUNK_HASH_EXT), []byte(hash))
+}
+
+func (chunks chunkStore) localChunk(sum string) ([]byte, bool) {
+	if chunks.options.Dir == "" {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(chunks.path(sum, __CHUNK_DATA_EXT))
+
+	if err != nil || hashData(data) != sum {
+		return nil, false
+	}
+
+	return data, true
+}
+
+func (chunks chunkStore) saveChunk(sum string, data []byte) {
+	chunks.writeLocal(chunks.path(sum, __CHUNK_DATA_EXT), data)
+}
+
+func (chunks chunkStore) forgetChunk(sum string) {
+	if chunks.options.Dir == "" {
+		return
+	}
+
+	err := os.Remove(chunks.path(sum, __CHUNK_DATA_EXT))
+
+	if err != nil && !os.IsNotExist(err) {
+		useLogger(chunks.logger).Log(LOG_WARN, "Failed to remove chunk", LogField{Key: "sum", Value: sum}, errorField(err))
+	}
+}
+
+func (chunks chunkStore) writeLocal(path string, data []byte) {
+	if chunks.options.Dir == "" {
+		return
+	}
+
+	err := os.MkdirAll(chunks.options.Dir, __CACHE_DIR_MODE)
+
+	if err == nil {
+		err = writeFileAtomic(path, data)
+	}
+
+	if err != nil {
+		useLogger(chunks.logger).Log(LOG_WARN, "Failed to record chunk", LogField{Key: "path", Value: path}, errorField(err))
+	}
+}
+
+func (chunks chunkStore) path(sum, ext string) string {
+	return filepath.Join(chunks.options.Dir, sum+ext)
+}
+
+func splitChunks(data []byte) [][]byte {
+	chunks := [][]byte{}
+
+	for len(data) > 0 {
+		size := nextChunkSize(data)
+		chunks = append(chunks, data[:size])
+		data = data[size:]
+	}
+
+	return chunks
+}
+
+// nextChunkSize finds a chunk boundary using a gear rolling hash, so that
+// boundaries move with the content rather than with byte offsets.
+func nextChunkSize(data []byte) int {
+	if len(data) <= __MIN_CHUNK_SIZE {
+		return len(data)
+	}
+
+	limit := len(data)
+	if limit > __MAX_CHUNK_SIZE {
+		limit = __MAX_CHUNK_SIZE
+	}
+
+	var hash uint64
+	for i := __MIN_CHUNK_SIZE; i < limit; i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+
+		if hash&__CHUNK_MASK == 0 {
+			return i + 1
+		}
+	}
+
+	return limit
+}
+
+var gearTable = makeGearTable()
+
+func makeGearTable() [256]uint64 {
+	table := [256]uint64{}
+
+	// splitmix64 with a fixed seed so that every peer chunks identically.
+	state := uint64(__GEAR_SEED)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+
+	return table
+}
+
+func chunkHashes(store ContentAddressableStorage, path string) ([]string, error) {
+	chunks := chunkStore{store: store}
+	manifest, err := chunks.readManifest(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(manifest.Chunks))
+	for _, ref := range manifest.Chunks {
+		hashes = append(hashes, ref.Hash)
+	}
+
+	return hashes, nil
+}
+
+const STORAGE_KEY = "storage"
+const CHUNKED_STORAGE = "chunked"
+const __MIN_CHUNK_SIZE = 256 * 1024
+const __MAX_CHUNK_SIZE = 4 * 1024 * 1024
+const __CHUNK_MASK = uint64(0xfffff) << 44
+const __GEAR_SEED = 0x706b677468696e67
+const __CHUNK_HASH_EXT = ".hash"
+const __CHUNK_DATA_EXT = ".chunk"
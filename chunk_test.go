@@ -0,0 +1,228 @@
+package pkgthing
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestSplitChunksBounds(t *testing.T) {
+	data := testRandomData(1, 20*1024*1024)
+	chunks := splitChunks(data)
+
+	if !bytes.Equal(bytes.Join(chunks, nil), data) {
+		t.Fatal("Chunks did not join to the original data")
+	}
+
+	for i, chunk := range chunks {
+		if len(chunk) > __MAX_CHUNK_SIZE {
+			t.Errorf("Chunk %d was %d bytes, larger than the maximum", i, len(chunk))
+		}
+
+		if i < len(chunks)-1 && len(chunk) < __MIN_CHUNK_SIZE {
+			t.Errorf("Chunk %d was %d bytes, smaller than the minimum", i, len(chunk))
+		}
+	}
+}
+
+func TestSplitChunksContentDefined(t *testing.T) {
+	data := testRandomData(2, 16*1024*1024)
+
+	edited := append([]byte{}, data[:100]...)
+	edited = append(edited, []byte("inserted near the start")...)
+	edited = append(edited, data[100:]...)
+
+	before := chunkSums(splitChunks(data))
+	after := chunkSums(splitChunks(edited))
+
+	shared := 0
+	for sum := range after {
+		if before[sum] {
+			shared++
+		}
+	}
+
+	if shared < len(before)-2 {
+		t.Errorf("Expected an insertion to change at most two chunks but only %d of %d were shared", shared, len(before))
+	}
+}
+
+func TestChunkStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkgthing-chunks")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	data := testRandomData(3, 6*1024*1024)
+	options := ChunkOptions{Threshold: 1024, Dir: dir}
+
+	source := chunkStore{store: makeMemoryStorage(), options: options}
+	path, err := source.add(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := source.cat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(actual, data) {
+		t.Error("Chunked data did not round trip")
+	}
+}
+
+func TestChunkStoreOpenStreams(t *testing.T) {
+	data := testRandomData(5, 6*1024*1024)
+	chunks := chunkStore{store: makeMemoryStorage(), options: ChunkOptions{Threshold: 1024}}
+	path, err := chunks.add(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := chunks.open(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	actual, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(actual, data) {
+		t.Error("Streamed chunks did not match the original data")
+	}
+}
+
+func TestChunkStoreAddsKnownChunksToEveryStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkgthing-chunks")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	data := testRandomData(4, 6*1024*1024)
+	options := ChunkOptions{Threshold: 1024, Dir: dir}
+
+	first := chunkStore{store: makeMemoryStorage(), options: options}
+	_, err = first.add(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second store sharing the chunk directory must still receive every chunk.
+	secondStore := makeMemoryStorage()
+	second := chunkStore{store: secondStore, options: options}
+	path, err := second.add(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes, err := chunkHashes(secondStore, path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hash := range hashes {
+		if !secondStore.has(hash) {
+			t.Errorf("Chunk '%s' was not added to the second store", hash)
+		}
+	}
+}
+
+func TestChunkStoreResumesInterruptedAdd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkgthing-chunks")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	data := testRandomData(5, 6*1024*1024)
+	parts := len(splitChunks(data))
+	options := ChunkOptions{Threshold: 1024, Dir: dir}
+
+	store := &interruptingStorage{memoryStorage: makeMemoryStorage(), remaining: 2}
+	chunks := chunkStore{store: store, options: options}
+	_, err = chunks.add(data)
+
+	if err == nil {
+		t.Fatal("Expected the interrupted add to fail")
+	}
+
+	store.remaining = -1
+	path, err := chunks.add(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The two chunks finished before the interruption are only pinned, so
+	// the resumed add uploads the rest and the manifest.
+	if expected := parts + 1; store.adds != expected {
+		t.Errorf("Expected %d adds in total but got %d", expected, store.adds)
+	}
+
+	actual, err := chunks.cat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(actual, data) {
+		t.Error("Resumed chunks did not match the original data")
+	}
+}
+
+// interruptingStorage fails every add after the remaining count, unless it is
+// negative.
+type interruptingStorage struct {
+	*memoryStorage
+	remaining int
+}
+
+func (store *interruptingStorage) Add(r io.Reader) (string, error) {
+	if store.remaining == 0 {
+		return "", errors.New("Interrupted")
+	}
+
+	store.remaining--
+	return store.memoryStorage.Add(r)
+}
+
+func chunkSums(chunks [][]byte) map[string]bool {
+	sums := map[string]bool{}
+	for _, chunk := range chunks {
+		sums[hashData(chunk)] = true
+	}
+
+	return sums
+}
+
+func testRandomData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
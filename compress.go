@@ -0,0 +1,186 @@
+package pkgthing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+)
+
+func ParseCompression(method string) (string, error) {
+	switch method {
+	case NO_COMPRESSION, ZSTD_COMPRESSION, XZ_COMPRESSION:
+		return method, nil
+	default:
+		return "", fmt.Errorf("Unknown compression: %s", method)
+	}
+}
+
+func compressData(method string, data []byte) ([]byte, error) {
+	switch method {
+	case ZSTD_COMPRESSION:
+		encoder, err := zstd.NewWriter(nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer encoder.Close()
+
+		return encoder.EncodeAll(data, nil), nil
+	case XZ_COMPRESSION:
+		buff := &bytes.Buffer{}
+		writer, err := xz.NewWriter(buff)
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = writer.Write(data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = writer.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return buff.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("Unknown compression: %s", method)
+	}
+}
+
+func decompressData(method string, data []byte) ([]byte, error) {
+	switch method {
+	case NO_COMPRESSION:
+		return data, nil
+	case ZSTD_COMPRESSION:
+		decoder, err := zstd.NewReader(nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer decoder.Close()
+
+		return decoder.DecodeAll(data, nil)
+	case XZ_COMPRESSION:
+		reader, err := xz.NewReader(bytes.NewReader(data))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return ioutil.ReadAll(reader)
+	default:
+		return nil, fmt.Errorf("Unknown compression: %s", method)
+	}
+}
+
+// decompressReader streams the decompressed contents of stored, closing it
+// when the result is closed.
+func decompressReader(method string, stored io.ReadCloser) (io.ReadCloser, error) {
+	switch method {
+	case NO_COMPRESSION:
+		return stored, nil
+	case ZSTD_COMPRESSION:
+		decoder, err := zstd.NewReader(stored)
+
+		if err != nil {
+			stored.Close()
+			return nil, err
+		}
+
+		closer := func() error {
+			decoder.Close()
+			return stored.Close()
+		}
+
+		return decodingReader{Reader: decoder, close: closer}, nil
+	case XZ_COMPRESSION:
+		reader, err := xz.NewReader(stored)
+
+		if err != nil {
+			stored.Close()
+			return nil, err
+		}
+
+		return decodingReader{Reader: reader, close: stored.Close}, nil
+	default:
+		stored.Close()
+		return nil, fmt.Errorf("Unknown compression: %s", method)
+	}
+}
+
+type decodingReader struct {
+	io.Reader
+	close func() error
+}
+
+func (reader decodingReader) Close() error {
+	return reader.close()
+}
+
+// encodePackage returns the bytes to store for the package, recording the
+// compression in its metadata when compressing actually saved space.
+// Packages large enough to be chunked are not compressed, so that chunks of
+// consecutive versions still match.
+func (thing *pkgthing) encodePackage(pack *Package) ([]byte, error) {
+	if thing.Compression == NO_COMPRESSION || thing.chunks.shouldChunk(pack.Data) {
+		return pack.Data, nil
+	}
+
+	compressed, err := compressData(thing.Compression, pack.Data)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "encodePackage failed")
+	}
+
+	if len(compressed) >= len(pack.Data) {
+		return pack.Data, nil
+	}
+
+	pack.PackageInfo = pack.withMetaData(COMPRESSION_KEY, thing.Compression)
+	return compressed, nil
+}
+
+func decodePackageData(info PackageInfo, stored []byte) ([]byte, error) {
+	data, err := decompressData(info.GetMetaData(COMPRESSION_KEY), stored)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "decodePackageData failed")
+	}
+
+	return data, nil
+}
+
+// withoutEncoding drops metadata describing how the package is stored, which
+// only the Adder that stores it may set.
+func (info PackageInfo) withoutEncoding() PackageInfo {
+	for _, key := range __ENCODING_KEYS {
+		info = info.withoutMetaData(key)
+	}
+
+	return info
+}
+
+var __ENCODING_KEYS = []string{
+	STORAGE_KEY,
+	COMPRESSION_KEY,
+	DELTA_BASE_KEY,
+	DELTA_PATH_KEY,
+	DELTA_BASE_COMPRESSION_KEY,
+}
+
+const COMPRESSION_KEY = "compression"
+const NO_COMPRESSION = ""
+const ZSTD_COMPRESSION = "zstd"
+const XZ_COMPRESSION = "xz"
@@ -0,0 +1,197 @@
+package pkgthing
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("pkgthing compresses package blobs "), 1000)
+
+	for _, method := range []string{ZSTD_COMPRESSION, XZ_COMPRESSION} {
+		compressed, err := compressData(method, data)
+
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+
+		if len(compressed) >= len(data) {
+			t.Errorf("%s: expected compression to save space", method)
+		}
+
+		actual, err := decompressData(method, compressed)
+
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+
+		if !bytes.Equal(actual, data) {
+			t.Errorf("%s: data did not round trip", method)
+		}
+	}
+}
+
+func TestDecompressReader(t *testing.T) {
+	data := bytes.Repeat([]byte("pkgthing streams package blobs "), 1000)
+
+	for _, method := range []string{NO_COMPRESSION, ZSTD_COMPRESSION, XZ_COMPRESSION} {
+		stored := data
+		if method != NO_COMPRESSION {
+			var err error
+			stored, err = compressData(method, data)
+
+			if err != nil {
+				t.Fatalf("%s: %v", method, err)
+			}
+		}
+
+		reader, err := decompressReader(method, ioutil.NopCloser(bytes.NewReader(stored)))
+
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+
+		actual, err := ioutil.ReadAll(reader)
+		reader.Close()
+
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+
+		if !bytes.Equal(actual, data) {
+			t.Errorf("%s: streamed data did not round trip", method)
+		}
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for _, method := range []string{NO_COMPRESSION, ZSTD_COMPRESSION, XZ_COMPRESSION} {
+		_, err := ParseCompression(method)
+
+		if err != nil {
+			t.Errorf("Unexpected error for '%s': %v", method, err)
+		}
+	}
+
+	_, err := ParseCompression("gzip")
+
+	if err == nil {
+		t.Error("Expected error for unknown compression")
+	}
+}
+
+func TestStorePackageCompresses(t *testing.T) {
+	store := makeMemoryStorage()
+	thing := testCompressingPkgthing(store, 0)
+
+	pack := Package{
+		PackageInfo: PackageInfo{Name: "bash", System: "ubuntu"},
+		Data:        bytes.Repeat([]byte("bash "), 1000),
+	}
+
+	err := thing.storePackage(&pack)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pack.GetMetaData(COMPRESSION_KEY) != ZSTD_COMPRESSION {
+		t.Errorf("Expected zstd compression but got '%s'", pack.GetMetaData(COMPRESSION_KEY))
+	}
+
+	loaded := Package{PackageInfo: pack.PackageInfo}
+	err = thing.loadPackageData(&loaded)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(loaded.Data, pack.Data) {
+		t.Error("Compressed package did not round trip")
+	}
+}
+
+func TestStorePackageDoesNotCompressChunks(t *testing.T) {
+	store := makeMemoryStorage()
+	thing := testCompressingPkgthing(store, 1024)
+
+	pack := Package{
+		PackageInfo: PackageInfo{Name: "bash", System: "ubuntu"},
+		Data:        bytes.Repeat([]byte("bash "), 1000),
+	}
+
+	err := thing.storePackage(&pack)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isChunked(pack.PackageInfo) {
+		t.Error("Expected package to be chunked")
+	}
+
+	if method := pack.GetMetaData(COMPRESSION_KEY); method != NO_COMPRESSION {
+		t.Errorf("Expected chunked package to be uncompressed but got '%s'", method)
+	}
+}
+
+func TestStorePackageStripsCallerEncoding(t *testing.T) {
+	store := makeMemoryStorage()
+	thing := testCompressingPkgthing(store, 0)
+	thing.Compression = NO_COMPRESSION
+
+	data := []byte("not compressed at all")
+	pack := Package{
+		PackageInfo: PackageInfo{
+			Name:   "bash",
+			System: "ubuntu",
+			MetaData: []MetaDataEntry{
+				{MetaDataKey: COMPRESSION_KEY, MetaDataValue: XZ_COMPRESSION},
+				{MetaDataKey: STORAGE_KEY, MetaDataValue: CHUNKED_STORAGE},
+				{MetaDataKey: DELTA_PATH_KEY, MetaDataValue: "elsewhere"},
+				{MetaDataKey: VERSION_KEY, MetaDataValue: "4.4"},
+			},
+		},
+		Data: data,
+	}
+
+	err := thing.storePackage(&pack)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range __ENCODING_KEYS {
+		if value := pack.GetMetaData(key); value != "" {
+			t.Errorf("Expected caller '%s' to be dropped but was '%s'", key, value)
+		}
+	}
+
+	if pack.GetMetaData(VERSION_KEY) != "4.4" {
+		t.Error("Expected other metadata to be kept")
+	}
+
+	loaded := Package{PackageInfo: pack.PackageInfo}
+	err = thing.loadPackageData(&loaded)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(loaded.Data, data) {
+		t.Error("Package did not round trip")
+	}
+}
+
+func testCompressingPkgthing(store ContentAddressableStorage, threshold int) *pkgthing {
+	options := Options{
+		Store:       store,
+		Compression: ZSTD_COMPRESSION,
+		Chunks: ChunkOptions{
+			Threshold: threshold,
+		},
+	}
+
+	return New(options).(*pkgthing)
+}
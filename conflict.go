@@ -0,0 +1,389 @@
+package pkgthing
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Publication is recorded with every Add. Godless merges concurrent Adds of
+// the same name into one row with many datapaths, so publications are how
+// each datapath keeps its own metadata and publisher.
+type Publication struct {
+	IpfsPath   string
+	MetaData   []MetaDataEntry
+	Time       time.Time
+	Signatures []Signature
+}
+
+func makePublication(info PackageInfo) Publication {
+	return Publication{
+		IpfsPath:   info.IpfsPath,
+		MetaData:   info.MetaData,
+		Time:       info.Published,
+		Signatures: info.Signatures,
+	}
+}
+
+func publicationPayload(info PackageInfo) []byte {
+	buff := &bytes.Buffer{}
+	fmt.Fprintf(buff, "publish\n%s\n%s\n%s\n%s\n", info.System, info.Name, info.IpfsPath, info.Published.UTC().Format(time.RFC3339Nano))
+
+	for _, entry := range info.MetaData {
+		fmt.Fprintf(buff, "%s=%s\n", entry.MetaDataKey, entry.MetaDataValue)
+	}
+
+	return buff.Bytes()
+}
+
+// publicationCandidates returns a candidate for each distinct set of metadata
+// published for the blob at info.IpfsPath. Each candidate carries only the
+// signatures over its own metadata, so a publication can never borrow the
+// signatures of another. Without publications info is the only candidate.
+func publicationCandidates(info PackageInfo, pubs []Publication) []PackageInfo {
+	if len(pubs) == 0 {
+		return []PackageInfo{info}
+	}
+
+	candidates := []PackageInfo{}
+	byMetaData := map[string]int{}
+
+	for _, pub := range pubs {
+		candidate := info
+		candidate.MetaData = pub.MetaData
+		candidate.Published = pub.Time
+		candidate.Signatures = nil
+
+		identity := metaDataIdentity(pub.MetaData)
+		i, present := byMetaData[identity]
+
+		if !present {
+			i = len(candidates)
+			byMetaData[identity] = i
+			candidates = append(candidates, candidate)
+		}
+
+		payload := publicationPayload(candidate)
+		for _, sig := range pub.Signatures {
+			if sig.Verify(payload) {
+				candidates[i].Signatures = append(candidates[i].Signatures, sig)
+			}
+		}
+	}
+
+	return candidates
+}
+
+func metaDataIdentity(metadata []MetaDataEntry) string {
+	lines := make([]string, 0, len(metadata))
+	for _, entry := range metadata {
+		lines = append(lines, entry.MetaDataKey+"="+entry.MetaDataValue)
+	}
+
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func (thing *pkgthing) signPublication(info PackageInfo) (PackageInfo, error) {
+	info.Published = time.Now().UTC()
+	info.Signatures = nil
+
+	if thing.Signer == nil {
+		return info, nil
+	}
+
+	sig, err := thing.Signer.Sign(publicationPayload(info))
+
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	info.Signatures = []Signature{sig}
+	return info, nil
+}
+
+// CoSign publishes info again, with the same metadata, signed by this
+// pkgthing's key. Readers merge the signatures of identical publications, so
+// the package then carries both keys' signatures.
+func (thing *pkgthing) CoSign(info PackageInfo) error {
+	const failMsg = "CoSign failed"
+
+	if thing.Signer == nil {
+		return errors.New(failMsg + ": no signing key")
+	}
+
+	if info.IpfsPath == "" {
+		return errors.New(failMsg + ": no IpfsPath")
+	}
+
+	signed, err := thing.signPublication(info)
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	err = thing.addRecord(signed, __PUBLICATION_KEY, makePublication(signed))
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	return nil
+}
+
+// Republish records a publication made elsewhere, such as in the index a
+// mirror copies from, keeping its time and the signatures that verify, and
+// adding this pkgthing's signature alongside them. The blob at info.IpfsPath
+// must already be in this pkgthing's CAS.
+func (thing *pkgthing) Republish(info PackageInfo) (PackageInfo, error) {
+	const failMsg = "Republish failed"
+
+	if info.IpfsPath == "" {
+		return PackageInfo{}, errors.New(failMsg + ": no IpfsPath")
+	}
+
+	signed, err := thing.coSignPublication(info)
+
+	if err != nil {
+		return PackageInfo{}, errors.Wrap(err, failMsg)
+	}
+
+	err = thing.index(signed)
+
+	if err != nil {
+		return PackageInfo{}, errors.Wrap(err, failMsg)
+	}
+
+	return signed, nil
+}
+
+// coSignPublication keeps the signatures over info's publication that verify,
+// then adds this pkgthing's own unless it has already signed.
+func (thing *pkgthing) coSignPublication(info PackageInfo) (PackageInfo, error) {
+	payload := publicationPayload(info)
+
+	signatures := []Signature{}
+	for _, sig := range info.Signatures {
+		if sig.Verify(payload) {
+			signatures = append(signatures, sig)
+		}
+	}
+
+	info.Signatures = signatures
+
+	if thing.Signer == nil || info.IsSignedBy(thing.Signer.Reference()) {
+		return info, nil
+	}
+
+	sig, err := thing.Signer.Sign(payload)
+
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	info.Signatures = append(info.Signatures, sig)
+	return info, nil
+}
+
+func (info PackageInfo) IsSignedBy(key KeyReference) bool {
+	for _, sig := range info.Signatures {
+		if sig.Fingerprint.Type == key.Type && bytes.Equal(sig.Fingerprint.Fingerprint, key.Fingerprint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func signedByAny(allInfo []PackageInfo, keys []KeyReference) []PackageInfo {
+	signed := []PackageInfo{}
+
+	for _, info := range allInfo {
+		for _, key := range keys {
+			if info.IsSignedBy(key) {
+				signed = append(signed, info)
+				break
+			}
+		}
+	}
+
+	return signed
+}
+
+type ConflictPolicy interface {
+	Choose(candidates []PackageInfo) (PackageInfo, error)
+}
+
+// NewestPolicy picks the candidate with the highest version, then the most
+// recently published, then the lowest IpfsPath so that every peer makes the
+// same choice. Publication times are chosen by the publisher, so times in the
+// future are ignored; check candidates against a trust policy first if
+// untrusted publishers could claim a higher version.
+type NewestPolicy struct{}
+
+func (policy NewestPolicy) Choose(candidates []PackageInfo) (PackageInfo, error) {
+	if len(candidates) == 0 {
+		return PackageInfo{}, errors.New("No candidates")
+	}
+
+	sorted := make([]PackageInfo, len(candidates))
+	copy(sorted, candidates)
+
+	now := time.Now()
+	sort.SliceStable(sorted, func(i, j int) bool {
+		order := CompareVersions(sorted[i].GetMetaData(VERSION_KEY), sorted[j].GetMetaData(VERSION_KEY))
+
+		if order != 0 {
+			return order > 0
+		}
+
+		iPublished := pastTime(sorted[i].Published, now)
+		jPublished := pastTime(sorted[j].Published, now)
+
+		if !iPublished.Equal(jPublished) {
+			return iPublished.After(jPublished)
+		}
+
+		return sorted[i].IpfsPath < sorted[j].IpfsPath
+	})
+
+	return sorted[0], nil
+}
+
+func pastTime(t, now time.Time) time.Time {
+	if t.After(now) {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// TrustedKeyPolicy picks among candidates signed by one of Keys, using
+// Fallback (or failing, if nil) when none are.
+type TrustedKeyPolicy struct {
+	Keys     []KeyReference
+	Fallback ConflictPolicy
+}
+
+func (policy TrustedKeyPolicy) Choose(candidates []PackageInfo) (PackageInfo, error) {
+	trusted := signedByAny(candidates, policy.Keys)
+
+	if len(trusted) > 0 {
+		return NewestPolicy{}.Choose(trusted)
+	}
+
+	if policy.Fallback != nil {
+		return policy.Fallback.Choose(candidates)
+	}
+
+	return PackageInfo{}, errors.New("No candidate signed by a trusted key")
+}
+
+// Conflict is one version of a package published as more than one blob.
+type Conflict struct {
+	System       string
+	Name         string
+	Version      string
+	Architecture string
+	Candidates   []PackageInfo
+}
+
+// FindConflicts reports versions of packages that were published with
+// different IpfsPaths for the same architecture. New versions of a package
+// are not conflicts.
+func FindConflicts(searcher PackageSearcher, system string) ([]Conflict, error) {
+	term := PackageSearchTerm{
+		SearchKey: SEARCH_SYSTEM,
+		System:    system,
+	}
+
+	found, err := searcher.Search(term)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "FindConflicts failed")
+	}
+
+	conflicts := []Conflict{}
+	for _, candidates := range groupBy(found, conflictKey) {
+		if countPaths(candidates) < 2 {
+			continue
+		}
+
+		first := candidates[0]
+		conflict := Conflict{
+			System:       system,
+			Name:         first.Name,
+			Version:      first.GetMetaData(VERSION_KEY),
+			Architecture: first.GetMetaData(ARCHITECTURE_KEY),
+			Candidates:   candidates,
+		}
+
+		conflicts = append(conflicts, conflict)
+	}
+
+	return conflicts, nil
+}
+
+func conflictKey(info PackageInfo) string {
+	return diffKey(info) + ":" + info.GetMetaData(VERSION_KEY)
+}
+
+func countPaths(candidates []PackageInfo) int {
+	paths := map[string]bool{}
+	for _, info := range candidates {
+		paths[info.IpfsPath] = true
+	}
+
+	return len(paths)
+}
+
+// chooseEach collapses candidates to one PackageInfo per name.
+func chooseEach(allInfo []PackageInfo, policy ConflictPolicy) ([]PackageInfo, error) {
+	chosen := []PackageInfo{}
+
+	for _, candidates := range groupByName(allInfo) {
+		info, err := policy.Choose(candidates)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to choose '%s'", candidates[0].Name)
+		}
+
+		chosen = append(chosen, info)
+	}
+
+	return chosen, nil
+}
+
+func groupByName(allInfo []PackageInfo) [][]PackageInfo {
+	return groupBy(allInfo, func(info PackageInfo) string {
+		return info.System + "/" + info.Name
+	})
+}
+
+func groupBy(allInfo []PackageInfo, key func(PackageInfo) string) [][]PackageInfo {
+	byKey := map[string][]PackageInfo{}
+	keys := []string{}
+
+	for _, info := range allInfo {
+		k := key(info)
+
+		if _, present := byKey[k]; !present {
+			keys = append(keys, k)
+		}
+
+		byKey[k] = append(byKey[k], info)
+	}
+
+	sort.Strings(keys)
+
+	groups := make([][]PackageInfo, 0, len(keys))
+	for _, k := range keys {
+		groups = append(groups, byKey[k])
+	}
+
+	return groups
+}
@@ -0,0 +1,195 @@
+package pkgthing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublicationCandidatesBindMetaDataToSignatures(t *testing.T) {
+	key := testKey(t)
+
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	info.IpfsPath = "bash-path"
+	published := testPublish(t, info, key)
+
+	// A backdated publication of the same blob with the attacker's metadata,
+	// carrying a copy of the real signature.
+	forged := Publication{
+		IpfsPath:   info.IpfsPath,
+		MetaData:   published.withMetaData(SHA256_KEY, "attacker").MetaData,
+		Time:       published.Published.Add(-time.Hour),
+		Signatures: published.Signatures,
+	}
+
+	pubs := []Publication{forged, makePublication(published)}
+	row := PackageInfo{System: info.System, Name: info.Name, IpfsPath: info.IpfsPath}
+
+	candidates := publicationCandidates(row, pubs)
+
+	if len(candidates) != 2 {
+		t.Fatalf("Expected 2 candidates but got %d", len(candidates))
+	}
+
+	for _, candidate := range candidates {
+		signed := candidate.IsSignedBy(key.Reference())
+		forgedCandidate := candidate.GetMetaData(SHA256_KEY) == "attacker"
+
+		if forgedCandidate && signed {
+			t.Error("Forged metadata borrowed the publisher's signature")
+		}
+
+		if !forgedCandidate && !signed {
+			t.Error("Expected the real publication to be signed")
+		}
+	}
+}
+
+func TestPublicationCandidatesMergeCoSigners(t *testing.T) {
+	first := testKey(t)
+	second := testKey(t)
+
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	info.IpfsPath = "bash-path"
+
+	pubs := []Publication{
+		makePublication(testPublish(t, info, first)),
+		makePublication(testPublish(t, info, second)),
+	}
+
+	candidates := publicationCandidates(info, pubs)
+
+	if len(candidates) != 1 {
+		t.Fatalf("Expected 1 candidate but got %d", len(candidates))
+	}
+
+	if !candidates[0].IsSignedBy(first.Reference()) || !candidates[0].IsSignedBy(second.Reference()) {
+		t.Error("Expected both signatures on the candidate")
+	}
+}
+
+func TestCoSignPublicationKeepsSignatures(t *testing.T) {
+	publisher := testKey(t)
+	forger := testKey(t)
+	mirror := testKey(t)
+
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	info.IpfsPath = "bash-path"
+	info = testPublish(t, info, publisher)
+
+	forged := info
+	forged.IpfsPath = "forged-path"
+	forged = testPublish(t, forged, forger)
+	info.Signatures = append(info.Signatures, forged.Signatures...)
+
+	thing := &pkgthing{Options: Options{Signer: mirror}}
+	signed, err := thing.coSignPublication(info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(signed.Signatures) != 2 || !signed.IsSignedBy(publisher.Reference()) || !signed.IsSignedBy(mirror.Reference()) {
+		t.Fatalf("Expected the publisher and mirror signatures but got %v", signed.Signatures)
+	}
+
+	candidates := publicationCandidates(signed, []Publication{makePublication(signed)})
+
+	if len(candidates[0].Signatures) != 2 {
+		t.Error("Expected both signatures to verify")
+	}
+
+	again, err := thing.coSignPublication(signed)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(again.Signatures) != 2 {
+		t.Errorf("Expected no second mirror signature but got %d", len(again.Signatures))
+	}
+}
+
+func TestPublicationCandidatesWithoutPublications(t *testing.T) {
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	candidates := publicationCandidates(info, nil)
+
+	if len(candidates) != 1 || candidates[0].GetMetaData(VERSION_KEY) != "4.4" {
+		t.Errorf("Expected the row metadata as the only candidate but got %v", candidates)
+	}
+}
+
+func TestFindConflicts(t *testing.T) {
+	withPath := func(info PackageInfo, path string) PackageInfo {
+		info.IpfsPath = path
+		return info
+	}
+
+	found := []PackageInfo{
+		withPath(testPackageInfo("ubuntu", "bash", "4.3", "amd64"), "bash-4.3"),
+		withPath(testPackageInfo("ubuntu", "bash", "4.4", "amd64"), "bash-4.4"),
+		withPath(testPackageInfo("ubuntu", "bash", "4.4", "i386"), "bash-4.4-i386"),
+		withPath(testPackageInfo("ubuntu", "vim", "7.4", "amd64"), "vim-a"),
+		withPath(testPackageInfo("ubuntu", "vim", "7.4", "amd64"), "vim-b"),
+		withPath(testPackageInfo("ubuntu", "curl", "7.47", "amd64"), "curl"),
+		withPath(testPackageInfo("ubuntu", "curl", "7.47", "amd64"), "curl"),
+	}
+
+	conflicts, err := FindConflicts(&fakeSearcher{found: found}, "ubuntu")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict but got %v", conflicts)
+	}
+
+	conflict := conflicts[0]
+	if conflict.Name != "vim" || conflict.Version != "7.4" || len(conflict.Candidates) != 2 {
+		t.Errorf("Expected the two vim 7.4 blobs to conflict but got %v", conflict)
+	}
+}
+
+func TestNewestPolicyPrefersHigherVersion(t *testing.T) {
+	old := testPackageInfo("ubuntu", "bash", "4.3", "amd64")
+	old.IpfsPath = "bash-4.3"
+	old.Published = time.Now().Add(-time.Minute)
+
+	current := testPackageInfo("ubuntu", "bash", "4.10", "amd64")
+	current.IpfsPath = "bash-4.10"
+	current.Published = time.Now().Add(-time.Hour)
+
+	chosen, err := NewestPolicy{}.Choose([]PackageInfo{old, current})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if chosen.IpfsPath != current.IpfsPath {
+		t.Errorf("Expected version 4.10 but got %s", chosen.GetMetaData(VERSION_KEY))
+	}
+}
+
+func TestNewestPolicyIgnoresFutureTimes(t *testing.T) {
+	honest := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	honest.IpfsPath = "bash-b"
+	honest.Published = time.Now().Add(-time.Minute)
+
+	backdated := honest
+	backdated.IpfsPath = "bash-c"
+	backdated.Published = time.Now().Add(-time.Hour)
+
+	future := honest
+	future.IpfsPath = "bash-a"
+	future.Published = time.Now().Add(24 * 365 * time.Hour)
+
+	chosen, err := NewestPolicy{}.Choose([]PackageInfo{future, backdated, honest})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if chosen.IpfsPath != honest.IpfsPath {
+		t.Errorf("Expected the most recent honest publication but got '%s'", chosen.IpfsPath)
+	}
+}
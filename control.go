@@ -0,0 +1,110 @@
+package pkgthing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ControlField is one field of a deb822 stanza, as found in Debian control
+// files and APT Packages indexes. Continuation lines keep their leading space.
+type ControlField struct {
+	Name  string
+	Value string
+}
+
+type ControlStanza []ControlField
+
+func (stanza ControlStanza) Get(name string) string {
+	for _, field := range stanza {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+
+	return ""
+}
+
+// controlMetaData records every field except those describing a particular
+// file, using the lower case field name as the key.
+func (stanza ControlStanza) controlMetaData(info PackageInfo) PackageInfo {
+	for _, field := range stanza {
+		key := strings.ToLower(field.Name)
+
+		if containsString(__CONTROL_SKIPPED_FIELDS, key) {
+			continue
+		}
+
+		info = info.withMetaData(key, field.Value)
+	}
+
+	return info
+}
+
+func ParseControl(r io.Reader) ([]ControlStanza, error) {
+	const errMsg = "ParseControl failed"
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), __MAX_CONTROL_LINE)
+
+	stanzas := []ControlStanza{}
+	stanza := ControlStanza{}
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(stanza) > 0 {
+				stanzas = append(stanzas, stanza)
+				stanza = ControlStanza{}
+			}
+		case strings.HasPrefix(line, "#"):
+		case line[0] == ' ' || line[0] == '\t':
+			if len(stanza) == 0 {
+				return nil, fmt.Errorf("%s: Continuation line without field: %s", errMsg, line)
+			}
+
+			stanza[len(stanza)-1].Value += "\n" + line
+		default:
+			colon := strings.Index(line, ":")
+
+			if colon <= 0 {
+				return nil, fmt.Errorf("%s: Malformed line: %s", errMsg, line)
+			}
+
+			field := ControlField{
+				Name:  line[:colon],
+				Value: strings.TrimSpace(line[colon+1:]),
+			}
+
+			stanza = append(stanza, field)
+		}
+	}
+
+	err := scanner.Err()
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	if len(stanza) > 0 {
+		stanzas = append(stanzas, stanza)
+	}
+
+	return stanzas, nil
+}
+
+var __CONTROL_SKIPPED_FIELDS = []string{
+	"package",
+	"filename",
+	"size",
+	"md5sum",
+	"sha1",
+	"sha512",
+	"description-md5",
+}
+
+const __MAX_CONTROL_LINE = 1 << 20
@@ -0,0 +1,58 @@
+package pkgthing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseControl(t *testing.T) {
+	text := `# comment
+Package: bash
+Version: 4.4-5
+Description: GNU Bourne Again SHell
+ Bash is an sh-compatible command language interpreter.
+ .
+ It has many extensions.
+
+Package: vim
+Filename: pool/main/v/vim/vim_7.4_amd64.deb
+`
+
+	stanzas, err := ParseControl(strings.NewReader(text))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stanzas) != 2 {
+		t.Fatalf("Expected 2 stanzas but got %d", len(stanzas))
+	}
+
+	if stanzas[0].Get("version") != "4.4-5" {
+		t.Errorf("Expected case insensitive field lookup but got '%s'", stanzas[0].Get("version"))
+	}
+
+	description := stanzas[0].Get("Description")
+	if !strings.HasSuffix(description, "\n .\n It has many extensions.") {
+		t.Errorf("Expected continuation lines to keep their leading space but got '%s'", description)
+	}
+
+	info := stanzas[1].controlMetaData(PackageInfo{Name: "vim"})
+	if info.GetMetaData("filename") != "" || info.GetMetaData("package") != "" {
+		t.Error("Expected file fields to be skipped")
+	}
+}
+
+func TestParseControlMalformed(t *testing.T) {
+	for _, text := range []string{
+		" continuation first\n",
+		"Package bash\n",
+		":novalue\n",
+	} {
+		_, err := ParseControl(strings.NewReader(text))
+
+		if err == nil {
+			t.Errorf("Expected '%s' to fail", text)
+		}
+	}
+}
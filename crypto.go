@@ -1,9 +1,22 @@
 package pkgthing
 
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
 type KeyType uint16
 
 const (
 	GODLESS_KEY = KeyType(iota)
+	ED25519_KEY
 )
 
 type SignatureBlob []byte
@@ -15,7 +28,128 @@ type KeyReference struct {
 	Fingerprint KeyFingerprint
 }
 
+func (ref KeyReference) String() string {
+	return hex.EncodeToString(ref.Fingerprint)
+}
+
+func ParseKeyReference(text string) (KeyReference, error) {
+	fingerprint, err := hex.DecodeString(strings.TrimSpace(text))
+
+	if err != nil {
+		return KeyReference{}, errors.Wrap(err, "ParseKeyReference failed")
+	}
+
+	if len(fingerprint) != ed25519.PublicKeySize {
+		return KeyReference{}, errors.New("ParseKeyReference failed: bad key size")
+	}
+
+	ref := KeyReference{
+		Type:        ED25519_KEY,
+		Fingerprint: KeyFingerprint(fingerprint),
+	}
+
+	return ref, nil
+}
+
 type Signature struct {
 	Fingerprint KeyReference
 	Data        SignatureBlob
 }
+
+// Verify checks the signature against its own key. ED25519_KEY fingerprints
+// are the public key, so no keyring is needed to verify; whether the key is
+// trusted is a separate question.
+func (sig Signature) Verify(data []byte) bool {
+	switch sig.Fingerprint.Type {
+	case ED25519_KEY:
+		if len(sig.Fingerprint.Fingerprint) != ed25519.PublicKeySize {
+			return false
+		}
+
+		public := ed25519.PublicKey(sig.Fingerprint.Fingerprint)
+		return ed25519.Verify(public, data, sig.Data)
+	default:
+		return false
+	}
+}
+
+type Signer interface {
+	Sign(data []byte) (Signature, error)
+	Reference() KeyReference
+}
+
+type Ed25519Key struct {
+	Private ed25519.PrivateKey
+}
+
+func GenerateEd25519Key() (Ed25519Key, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		return Ed25519Key{}, errors.Wrap(err, "GenerateEd25519Key failed")
+	}
+
+	return Ed25519Key{Private: private}, nil
+}
+
+func (key Ed25519Key) Sign(data []byte) (Signature, error) {
+	sig := Signature{
+		Fingerprint: key.Reference(),
+		Data:        ed25519.Sign(key.Private, data),
+	}
+
+	return sig, nil
+}
+
+func (key Ed25519Key) Reference() KeyReference {
+	public := key.Private.Public().(ed25519.PublicKey)
+
+	return KeyReference{
+		Type:        ED25519_KEY,
+		Fingerprint: KeyFingerprint(public),
+	}
+}
+
+func ReadEd25519Key(path string) (Ed25519Key, error) {
+	const errMsg = "ReadEd25519Key failed"
+
+	text, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return Ed25519Key{}, errors.Wrap(err, errMsg)
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(text)))
+
+	if err != nil {
+		return Ed25519Key{}, errors.Wrap(err, errMsg)
+	}
+
+	if len(seed) != ed25519.SeedSize {
+		return Ed25519Key{}, errors.New(errMsg + ": bad key size")
+	}
+
+	return Ed25519Key{Private: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+func WriteEd25519Key(path string, key Ed25519Key) error {
+	const errMsg = "WriteEd25519Key failed"
+
+	err := os.MkdirAll(filepath.Dir(path), __KEY_DIR_MODE)
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	text := hex.EncodeToString(key.Private.Seed()) + "\n"
+	err = ioutil.WriteFile(path, []byte(text), __KEY_FILE_MODE)
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	return nil
+}
+
+const __KEY_DIR_MODE = 0700
+const __KEY_FILE_MODE = 0600
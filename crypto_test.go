@@ -0,0 +1,67 @@
+package pkgthing
+
+import (
+	"testing"
+)
+
+func TestSignatureVerify(t *testing.T) {
+	key := testKey(t)
+	sig, err := key.Sign([]byte("signed"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sig.Verify([]byte("signed")) {
+		t.Error("Expected signature to verify")
+	}
+
+	if sig.Verify([]byte("tampered")) {
+		t.Error("Expected tampered data not to verify")
+	}
+}
+
+func TestParseKeyReference(t *testing.T) {
+	key := testKey(t)
+	ref, err := ParseKeyReference(key.Reference().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !containsKey([]KeyReference{key.Reference()}, ref) {
+		t.Error("Expected parsed key to match")
+	}
+
+	_, err = ParseKeyReference("abcd")
+
+	if err == nil {
+		t.Error("Expected error for short key")
+	}
+}
+
+func testKey(t *testing.T) Ed25519Key {
+	t.Helper()
+
+	key, err := GenerateEd25519Key()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// testPublish signs info as Add would.
+func testPublish(t *testing.T, info PackageInfo, signer Signer) PackageInfo {
+	t.Helper()
+
+	thing := &pkgthing{Options: Options{Signer: signer}}
+	info, err := thing.signPublication(info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return info
+}
@@ -0,0 +1,342 @@
+package pkgthing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// makeDelta encodes target as copies from base and inserted literals, using
+// the rsync weak checksum to find blocks of base that reappear in target.
+func makeDelta(base, target []byte) []byte {
+	encoder := &deltaEncoder{}
+	encoder.buff.WriteString(__DELTA_MAGIC)
+
+	index := indexBlocks(base)
+	literalStart := 0
+	i := 0
+
+	var sum weakSum
+	if len(target) >= __DELTA_BLOCK_SIZE {
+		sum = makeWeakSum(target[:__DELTA_BLOCK_SIZE])
+	}
+
+	for i+__DELTA_BLOCK_SIZE <= len(target) {
+		offset, length, found := findMatch(index, base, target, i, sum.key())
+
+		if found {
+			encoder.insert(target[literalStart:i])
+			encoder.copy(offset, length)
+
+			i += length
+			literalStart = i
+
+			if i+__DELTA_BLOCK_SIZE <= len(target) {
+				sum = makeWeakSum(target[i : i+__DELTA_BLOCK_SIZE])
+			}
+
+			continue
+		}
+
+		if i+__DELTA_BLOCK_SIZE < len(target) {
+			sum.roll(target[i], target[i+__DELTA_BLOCK_SIZE])
+		}
+
+		i++
+	}
+
+	encoder.insert(target[literalStart:])
+
+	return encoder.buff.Bytes()
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+	if !bytes.HasPrefix(delta, []byte(__DELTA_MAGIC)) {
+		return nil, errors.New("Not a delta")
+	}
+
+	reader := bytes.NewReader(delta[len(__DELTA_MAGIC):])
+	target := &bytes.Buffer{}
+
+	for reader.Len() > 0 {
+		op, err := reader.ReadByte()
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case __DELTA_COPY:
+			offset, err := binary.ReadUvarint(reader)
+
+			if err != nil {
+				return nil, err
+			}
+
+			length, err := binary.ReadUvarint(reader)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if offset+length > uint64(len(base)) {
+				return nil, fmt.Errorf("Delta copy out of range: %d+%d", offset, length)
+			}
+
+			target.Write(base[offset : offset+length])
+		case __DELTA_INSERT:
+			length, err := binary.ReadUvarint(reader)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if length > uint64(reader.Len()) {
+				return nil, fmt.Errorf("Delta insert out of range: %d", length)
+			}
+
+			literal := make([]byte, length)
+			_, err = reader.Read(literal)
+
+			if err != nil {
+				return nil, err
+			}
+
+			target.Write(literal)
+		default:
+			return nil, fmt.Errorf("Unknown delta op: %d", op)
+		}
+	}
+
+	return target.Bytes(), nil
+}
+
+type deltaEncoder struct {
+	buff bytes.Buffer
+}
+
+func (encoder *deltaEncoder) copy(offset, length int) {
+	encoder.buff.WriteByte(__DELTA_COPY)
+	encoder.writeUvarint(uint64(offset))
+	encoder.writeUvarint(uint64(length))
+}
+
+func (encoder *deltaEncoder) insert(literal []byte) {
+	if len(literal) == 0 {
+		return
+	}
+
+	encoder.buff.WriteByte(__DELTA_INSERT)
+	encoder.writeUvarint(uint64(len(literal)))
+	encoder.buff.Write(literal)
+}
+
+func (encoder *deltaEncoder) writeUvarint(x uint64) {
+	scratch := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(scratch, x)
+	encoder.buff.Write(scratch[:n])
+}
+
+func indexBlocks(base []byte) map[uint32][]int {
+	index := map[uint32][]int{}
+
+	for offset := 0; offset+__DELTA_BLOCK_SIZE <= len(base); offset += __DELTA_BLOCK_SIZE {
+		key := makeWeakSum(base[offset : offset+__DELTA_BLOCK_SIZE]).key()
+
+		if len(index[key]) < __DELTA_MAX_CANDIDATES {
+			index[key] = append(index[key], offset)
+		}
+	}
+
+	return index
+}
+
+func findMatch(index map[uint32][]int, base, target []byte, at int, key uint32) (int, int, bool) {
+	for _, offset := range index[key] {
+		if !bytes.Equal(base[offset:offset+__DELTA_BLOCK_SIZE], target[at:at+__DELTA_BLOCK_SIZE]) {
+			continue
+		}
+
+		length := __DELTA_BLOCK_SIZE
+		for offset+length < len(base) && at+length < len(target) && base[offset+length] == target[at+length] {
+			length++
+		}
+
+		return offset, length, true
+	}
+
+	return 0, 0, false
+}
+
+type weakSum struct {
+	a uint32
+	b uint32
+}
+
+func makeWeakSum(block []byte) weakSum {
+	sum := weakSum{}
+
+	for i, c := range block {
+		sum.a += uint32(c)
+		sum.b += uint32(len(block)-i) * uint32(c)
+	}
+
+	return sum
+}
+
+func (sum *weakSum) roll(out, in byte) {
+	sum.a = sum.a - uint32(out) + uint32(in)
+	sum.b = sum.b - __DELTA_BLOCK_SIZE*uint32(out) + sum.a
+}
+
+func (sum weakSum) key() uint32 {
+	return (sum.a & 0xffff) | (sum.b << 16)
+}
+
+// addDelta stores a delta against the previously published version of the
+// package, so that peers who have the old blob cached can skip the download.
+// Chunked packages are already deduplicated and so are skipped.
+func (thing *pkgthing) addDelta(pack Package) PackageInfo {
+	info := pack.PackageInfo
+
+	if isChunked(info) {
+		return info
+	}
+
+	base, ok := thing.findDeltaBase(info)
+
+	if !ok {
+		return info
+	}
+
+	err := thing.loadPackageData(&base)
+
+	if err != nil {
+		thing.logger().Log(LOG_WARN, "Failed to load delta base", packageFields(info, errorField(err))...)
+		return info
+	}
+
+	delta := makeDelta(base.Data, pack.Data)
+
+	if len(delta)*__DELTA_MIN_SAVING > len(pack.Data) {
+		return info
+	}
+
+	deltaPath, err := thing.addIpfsBlob(delta)
+
+	if err != nil {
+		thing.logger().Log(LOG_WARN, "Failed to add delta", packageFields(info, errorField(err))...)
+		return info
+	}
+
+	info = info.withMetaData(DELTA_BASE_KEY, base.IpfsPath)
+	info = info.withMetaData(DELTA_PATH_KEY, deltaPath)
+
+	if baseCompression := base.GetMetaData(COMPRESSION_KEY); baseCompression != NO_COMPRESSION {
+		info = info.withMetaData(DELTA_BASE_COMPRESSION_KEY, baseCompression)
+	}
+
+	return info
+}
+
+func (thing *pkgthing) findDeltaBase(info PackageInfo) (Package, bool) {
+	term := PackageSearchTerm{
+		SearchKey:  SEARCH_NAME,
+		SearchTerm: info.Name,
+		System:     info.System,
+	}
+
+	found, err := thing.Search(term)
+
+	if err != nil {
+		thing.logger().Log(LOG_WARN, "Failed to find delta base", packageFields(info, errorField(err))...)
+		return Package{}, false
+	}
+
+	candidates := []PackageInfo{}
+	for _, other := range found {
+		if other.Name != info.Name || other.IpfsPath == info.IpfsPath || isChunked(other) {
+			continue
+		}
+
+		candidates = append(candidates, other)
+	}
+
+	if len(candidates) == 0 {
+		return Package{}, false
+	}
+
+	newest, err := NewestPolicy{}.Choose(candidates)
+
+	if err != nil {
+		return Package{}, false
+	}
+
+	base := Package{
+		PackageInfo: newest,
+	}
+
+	return base, true
+}
+
+// loadFromDelta rebuilds the package from a locally cached base blob when the
+// full blob is not itself cached.
+func (thing *pkgthing) loadFromDelta(info PackageInfo) ([]byte, bool) {
+	basePath := info.GetMetaData(DELTA_BASE_KEY)
+	deltaPath := info.GetMetaData(DELTA_PATH_KEY)
+	sum := info.GetMetaData(SHA256_KEY)
+
+	if basePath == "" || deltaPath == "" || sum == "" {
+		return nil, false
+	}
+
+	local, ok := thing.Store.(LocalStorage)
+
+	if !ok || local.Has(info.IpfsPath) || !local.Has(basePath) {
+		return nil, false
+	}
+
+	base, err := thing.catBlob(basePath)
+
+	if err == nil {
+		base, err = decompressData(info.GetMetaData(DELTA_BASE_COMPRESSION_KEY), base)
+	}
+
+	if err != nil {
+		thing.logger().Log(LOG_WARN, "Failed to read delta base", packageFields(info, errorField(err))...)
+		return nil, false
+	}
+
+	delta, err := thing.catBlob(deltaPath)
+
+	if err != nil {
+		thing.logger().Log(LOG_WARN, "Failed to read delta", packageFields(info, errorField(err))...)
+		return nil, false
+	}
+
+	data, err := applyDelta(base, delta)
+
+	if err != nil {
+		thing.logger().Log(LOG_WARN, "Failed to apply delta", packageFields(info, errorField(err))...)
+		return nil, false
+	}
+
+	if hashData(data) != sum {
+		thing.logger().Log(LOG_WARN, "Checksum mismatch rebuilding from delta", packageFields(info)...)
+		return nil, false
+	}
+
+	return data, true
+}
+
+const DELTA_BASE_KEY = "delta_base"
+const DELTA_PATH_KEY = "delta_path"
+const DELTA_BASE_COMPRESSION_KEY = "delta_base_compression"
+const __DELTA_MIN_SAVING = 2
+const __DELTA_MAGIC = "PKGDELTA1"
+const __DELTA_COPY = 'C'
+const __DELTA_INSERT = 'I'
+const __DELTA_BLOCK_SIZE = 64
+const __DELTA_MAX_CANDIDATES = 8
@@ -0,0 +1,60 @@
+package pkgthing
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	base := testRandomData(1, 64*1024)
+
+	target := append([]byte{}, base[:20000]...)
+	target = append(target, []byte("inserted in the middle")...)
+	target = append(target, base[30000:]...)
+	target = append(target, testRandomData(2, 100)...)
+
+	for name, test := range map[string]struct{ base, target []byte }{
+		"edited": {base, target},
+		"same":   {base, base},
+		"empty":  {base, nil},
+		"short":  {nil, []byte("short")},
+	} {
+		delta := makeDelta(test.base, test.target)
+		actual, err := applyDelta(test.base, delta)
+
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if !bytes.Equal(actual, test.target) {
+			t.Errorf("%s: Expected delta to reproduce the target", name)
+		}
+	}
+
+	if delta := makeDelta(base, target); len(delta) > len(target)/4 {
+		t.Errorf("Expected a small delta for an edit but got %d bytes", len(delta))
+	}
+}
+
+func TestApplyDeltaRejectsBadInput(t *testing.T) {
+	base := testRandomData(1, 4096)
+	delta := makeDelta(base, base)
+
+	_, err := applyDelta(base, []byte("not a delta"))
+
+	if err == nil {
+		t.Error("Expected a missing magic to fail")
+	}
+
+	_, err = applyDelta(base[:100], delta)
+
+	if err == nil {
+		t.Error("Expected a copy beyond the base to fail")
+	}
+
+	_, err = applyDelta(base, delta[:len(delta)-1])
+
+	if err == nil {
+		t.Error("Expected a truncated delta to fail")
+	}
+}
@@ -0,0 +1,176 @@
+package pkgthing
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+type PackageChange struct {
+	Before PackageInfo
+	After  PackageInfo
+}
+
+type PackageDiff struct {
+	Added   []PackageInfo
+	Removed []PackageInfo
+	Changed []PackageChange
+}
+
+func (diff PackageDiff) IsEmpty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+func Diff(from, to PackageLister) (PackageDiff, error) {
+	const errMsg = "Diff failed"
+
+	beforeList, err := from.GetInstalledPackages()
+
+	if err != nil {
+		return PackageDiff{}, errors.Wrap(err, errMsg)
+	}
+
+	afterList, err := to.GetInstalledPackages()
+
+	if err != nil {
+		return PackageDiff{}, errors.Wrap(err, errMsg)
+	}
+
+	// Packages on different systems are matched by name and architecture
+	// alone, otherwise every package would show as removed and re-added.
+	key := diffKey
+	if !sameSystems(beforeList, afterList) {
+		key = crossSystemDiffKey
+	}
+
+	before := byDiffKey(beforeList, key)
+	after := byDiffKey(afterList, key)
+
+	diff := PackageDiff{}
+
+	for _, key := range sortedKeys(after) {
+		afterInfo := after[key]
+		beforeInfo, present := before[key]
+
+		if !present {
+			diff.Added = append(diff.Added, afterInfo)
+			continue
+		}
+
+		if isChanged(beforeInfo, afterInfo) {
+			change := PackageChange{
+				Before: beforeInfo,
+				After:  afterInfo,
+			}
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+
+	for _, key := range sortedKeys(before) {
+		if _, present := after[key]; !present {
+			diff.Removed = append(diff.Removed, before[key])
+		}
+	}
+
+	return diff, nil
+}
+
+// SystemLister lists the packages published to a system, with conflicting
+// candidates resolved by Policy (NewestPolicy when nil). Yanked packages are
+// left out of GetInstalledPackages but not GetAllCandidates, which must see
+// every blob the index references.
+type SystemLister struct {
+	Searcher PackageSearcher
+	System   string
+	Policy   ConflictPolicy
+}
+
+func (lister SystemLister) GetInstalledPackages() ([]PackageInfo, error) {
+	found, err := lister.GetAllCandidates()
+
+	if err != nil {
+		return nil, err
+	}
+
+	policy := lister.Policy
+	if policy == nil {
+		policy = NewestPolicy{}
+	}
+
+	return chooseEach(withoutYanked(found), policy)
+}
+
+func (lister SystemLister) GetAllCandidates() ([]PackageInfo, error) {
+	term := PackageSearchTerm{
+		SearchKey:     SEARCH_SYSTEM,
+		System:        lister.System,
+		IncludeYanked: true,
+	}
+
+	return lister.Searcher.Search(term)
+}
+
+func isChanged(before, after PackageInfo) bool {
+	if before.GetMetaData(VERSION_KEY) != after.GetMetaData(VERSION_KEY) {
+		return true
+	}
+
+	if before.IpfsPath == "" || after.IpfsPath == "" {
+		return false
+	}
+
+	return before.IpfsPath != after.IpfsPath
+}
+
+func byDiffKey(list []PackageInfo, key func(PackageInfo) string) map[string]PackageInfo {
+	byKey := make(map[string]PackageInfo, len(list))
+	for _, info := range list {
+		byKey[key(info)] = info
+	}
+
+	return byKey
+}
+
+func sortedKeys(byKey map[string]PackageInfo) []string {
+	keys := make([]string, 0, len(byKey))
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func sameSystems(before, after []PackageInfo) bool {
+	beforeSystems := systemSet(before)
+	afterSystems := systemSet(after)
+
+	if len(beforeSystems) != len(afterSystems) {
+		return false
+	}
+
+	for system := range beforeSystems {
+		if !afterSystems[system] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func systemSet(list []PackageInfo) map[string]bool {
+	systems := map[string]bool{}
+	for _, info := range list {
+		systems[info.System] = true
+	}
+
+	return systems
+}
+
+func diffKey(info PackageInfo) string {
+	return info.System + "/" + crossSystemDiffKey(info)
+}
+
+func crossSystemDiffKey(info PackageInfo) string {
+	return info.Name + ":" + info.GetMetaData(ARCHITECTURE_KEY)
+}
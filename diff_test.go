@@ -0,0 +1,126 @@
+package pkgthing
+
+import (
+	"testing"
+)
+
+func TestDiffSameSystem(t *testing.T) {
+	from := Snapshot{Packages: []PackageInfo{
+		testPackageInfo("ubuntu", "bash", "4.3", "amd64"),
+		testPackageInfo("ubuntu", "vim", "7.4", "amd64"),
+	}}
+	to := Snapshot{Packages: []PackageInfo{
+		testPackageInfo("ubuntu", "bash", "4.4", "amd64"),
+		testPackageInfo("ubuntu", "curl", "7.47", "amd64"),
+	}}
+
+	diff, err := Diff(from, to)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDiffNames(t, "added", diff.Added, "curl")
+	assertDiffNames(t, "removed", diff.Removed, "vim")
+
+	if len(diff.Changed) != 1 || diff.Changed[0].After.GetMetaData(VERSION_KEY) != "4.4" {
+		t.Errorf("Expected bash to change to 4.4 but got %v", diff.Changed)
+	}
+}
+
+func TestDiffAcrossSystems(t *testing.T) {
+	from := Snapshot{Packages: []PackageInfo{
+		testPackageInfo("xenial", "bash", "4.3", "amd64"),
+		testPackageInfo("xenial", "vim", "7.4", "amd64"),
+	}}
+	to := Snapshot{Packages: []PackageInfo{
+		testPackageInfo("bionic", "bash", "4.4", "amd64"),
+		testPackageInfo("bionic", "vim", "7.4", "amd64"),
+		testPackageInfo("bionic", "vim", "7.4", "i386"),
+	}}
+
+	diff, err := Diff(from, to)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDiffNames(t, "added", diff.Added, "vim")
+	assertDiffNames(t, "removed", diff.Removed)
+
+	if len(diff.Changed) != 1 || diff.Changed[0].Before.Name != "bash" {
+		t.Errorf("Expected only bash to change but got %v", diff.Changed)
+	}
+}
+
+func assertDiffNames(t *testing.T, kind string, actual []PackageInfo, expected ...string) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %d %s packages but got %v", len(expected), kind, actual)
+	}
+
+	for i, info := range actual {
+		if info.Name != expected[i] {
+			t.Errorf("Expected %s package %d to be '%s' but was '%s'", kind, i, expected[i], info.Name)
+		}
+	}
+}
+
+func testPackageInfo(system, name, version, arch string) PackageInfo {
+	return PackageInfo{
+		System: system,
+		Name:   name,
+		MetaData: []MetaDataEntry{
+			{MetaDataKey: VERSION_KEY, MetaDataValue: version},
+			{MetaDataKey: ARCHITECTURE_KEY, MetaDataValue: arch},
+		},
+	}
+}
+
+func TestSystemListerIncludesYankedCandidates(t *testing.T) {
+	key := testKey(t)
+
+	bash := testPublish(t, testPackageInfo("ubuntu", "bash", "4.4", "amd64"), key)
+	bash.IpfsPath = "bash-path"
+
+	vim := testPublish(t, testPackageInfo("ubuntu", "vim", "7.4", "amd64"), key)
+	vim.IpfsPath = "vim-path"
+	vim.Yanks = []Yank{testYank(t, vim, key)}
+
+	searcher := &fakeSearcher{found: []PackageInfo{bash, vim}}
+	lister := SystemLister{Searcher: searcher, System: "ubuntu"}
+
+	candidates, err := lister.GetAllCandidates()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !searcher.term.IncludeYanked {
+		t.Error("Expected GetAllCandidates to include yanked packages")
+	}
+
+	if len(candidates) != 2 {
+		t.Errorf("Expected 2 candidates but got %d", len(candidates))
+	}
+
+	installed, err := lister.GetInstalledPackages()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDiffNames(t, "installed", installed, "bash")
+}
+
+// fakeSearcher returns found for every search, ignoring yanks.
+type fakeSearcher struct {
+	found []PackageInfo
+	term  PackageSearchTerm
+}
+
+func (searcher *fakeSearcher) Search(term PackageSearchTerm) ([]PackageInfo, error) {
+	searcher.term = term
+	return searcher.found, nil
+}
@@ -0,0 +1,111 @@
+package pkgthing
+
+import (
+	"io"
+)
+
+// Observer receives progress events from long operations. Events may arrive
+// from several goroutines at once.
+type Observer interface {
+	Observe(event Event)
+}
+
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) Observe(event Event) {
+	f(event)
+}
+
+type EventKind uint8
+
+const (
+	EVENT_STARTED = EventKind(iota)
+	EVENT_TRANSFERRED
+	EVENT_DONE
+	EVENT_FAILED
+	EVENT_SKIPPED
+)
+
+func (kind EventKind) String() string {
+	switch kind {
+	case EVENT_STARTED:
+		return "started"
+	case EVENT_TRANSFERRED:
+		return "transferred"
+	case EVENT_DONE:
+		return "done"
+	case EVENT_FAILED:
+		return "failed"
+	case EVENT_SKIPPED:
+		return "skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes progress of an Operation on a package. Bytes is the count
+// transferred so far and Total the expected count, or zero if unknown. For
+// SYNC_OPERATION, Total is the number of packages listed.
+type Event struct {
+	Kind      EventKind
+	Operation string
+	Info      PackageInfo
+	Bytes     int64
+	Total     int64
+	Err       error
+}
+
+const GET_OPERATION = "get"
+const ADD_OPERATION = "add"
+const SYNC_OPERATION = "sync"
+const SYNC_PACKAGE_OPERATION = "sync-package"
+
+func notify(observer Observer, event Event) {
+	if observer != nil {
+		observer.Observe(event)
+	}
+}
+
+// notifyResult sends EVENT_DONE, or EVENT_FAILED if err is set.
+func notifyResult(observer Observer, event Event, err error) {
+	event.Kind = EVENT_DONE
+
+	if err != nil {
+		event.Kind = EVENT_FAILED
+		event.Err = err
+	}
+
+	notify(observer, event)
+}
+
+// progressReader sends EVENT_TRANSFERRED as it is read.
+type progressReader struct {
+	reader   io.Reader
+	observer Observer
+	event    Event
+}
+
+func observeReader(reader io.Reader, observer Observer, event Event) io.Reader {
+	if observer == nil {
+		return reader
+	}
+
+	event.Kind = EVENT_TRANSFERRED
+
+	return &progressReader{
+		reader:   reader,
+		observer: observer,
+		event:    event,
+	}
+}
+
+func (progress *progressReader) Read(p []byte) (int, error) {
+	n, err := progress.reader.Read(p)
+
+	if n > 0 {
+		progress.event.Bytes += int64(n)
+		progress.observer.Observe(progress.event)
+	}
+
+	return n, err
+}
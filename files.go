@@ -0,0 +1,176 @@
+package pkgthing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// PackageFiles lists and reads package files, so that a Syncer can publish
+// them. Each file's header is inspected when listed, so filters see its real
+// name and metadata; the whole file is only read by Get. Files that cannot be
+// inspected are named after the file. A file that cannot be read, or that is
+// the same package as another, fails when it is got rather than failing the
+// whole listing.
+type PackageFiles struct {
+	Paths  []string
+	System string
+
+	mutex      sync.Mutex
+	files      map[string]packageFile
+	duplicates []string
+}
+
+type packageFile struct {
+	path string
+	err  error
+}
+
+func (files *PackageFiles) GetInstalledPackages() ([]PackageInfo, error) {
+	listed := map[string]packageFile{}
+	duplicates := []string{}
+	allInfo := make([]PackageInfo, 0, len(files.Paths))
+	for _, path := range files.Paths {
+		info, err := files.inspectFile(path)
+
+		if err != nil {
+			info = files.fileInfo(path)
+		}
+
+		key := aptFileName(info)
+		if other, present := listed[key]; present {
+			if other.err == nil {
+				other.err = fmt.Errorf("'%s' and '%s' are the same package", other.path, path)
+				listed[key] = other
+			}
+
+			duplicates = append(duplicates, path)
+			continue
+		}
+
+		listed[key] = packageFile{path: path, err: err}
+		allInfo = append(allInfo, info)
+	}
+
+	files.mutex.Lock()
+	files.files = listed
+	files.duplicates = duplicates
+	files.mutex.Unlock()
+
+	return allInfo, nil
+}
+
+// Duplicates returns the files last listed that were the same package as an
+// earlier file. They are not listed themselves.
+func (files *PackageFiles) Duplicates() []string {
+	files.mutex.Lock()
+	defer files.mutex.Unlock()
+
+	return files.duplicates
+}
+
+func (files *PackageFiles) Get(info PackageInfo) (Package, error) {
+	const errMsg = "PackageFiles.Get failed"
+
+	files.mutex.Lock()
+	file, ok := files.files[aptFileName(info)]
+	files.mutex.Unlock()
+
+	if !ok {
+		return Package{}, fmt.Errorf("%s: Package '%s' is not a listed file", errMsg, info.Name)
+	}
+
+	if file.err != nil {
+		return Package{}, errors.Wrap(file.err, errMsg)
+	}
+
+	pack, err := files.readFile(file.path)
+
+	if err != nil {
+		return Package{}, errors.Wrap(err, errMsg)
+	}
+
+	return pack, nil
+}
+
+// inspectFile reads only as much of the file as InspectPackage needs.
+func (files *PackageFiles) inspectFile(path string) (PackageInfo, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	defer file.Close()
+
+	stat, err := file.Stat()
+
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	header, err := readPackageHeader(file, stat.Size())
+
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	return files.inspect(path, header)
+}
+
+func (files *PackageFiles) readFile(path string) (Package, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return Package{}, err
+	}
+
+	info, err := files.inspect(path, data)
+
+	if err != nil {
+		return Package{}, err
+	}
+
+	pack := Package{
+		PackageInfo: info,
+		Data:        data,
+	}
+
+	return pack, nil
+}
+
+func (files *PackageFiles) inspect(path string, data []byte) (PackageInfo, error) {
+	pack := Package{
+		PackageInfo: PackageInfo{
+			System: files.System,
+		},
+		Data: data,
+	}
+
+	pack, err := InspectPackage(pack)
+
+	if err != nil {
+		return PackageInfo{}, errors.Wrapf(err, "Failed to inspect '%s'", path)
+	}
+
+	if pack.Name == "" {
+		pack.Name = filepath.Base(path)
+	}
+
+	return pack.PackageInfo, nil
+}
+
+// fileInfo names a file after the whole file name, so that foo.tar.gz and
+// foo.tar.bz2 are different packages.
+func (files *PackageFiles) fileInfo(path string) PackageInfo {
+	info := PackageInfo{
+		Name:   filepath.Base(path),
+		System: files.System,
+	}
+
+	return info
+}
@@ -0,0 +1,87 @@
+package pkgthing
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackageFilesReportsDuplicatesPerFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkgthing-files")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	deb := testDeb(t, "bash", "4.4-1", "amd64", []byte("bash data"))
+	files := &PackageFiles{System: "ubuntu"}
+
+	for name, data := range map[string][]byte{
+		"bash.deb":        deb,
+		"bash-copy.deb":   deb,
+		"source.tar.gz":   []byte("gzipped source"),
+		"source.tar.bz2":  []byte("bzipped source"),
+		"unreadable.file": nil,
+	} {
+		path := filepath.Join(dir, name)
+		files.Paths = append(files.Paths, path)
+
+		if data != nil {
+			err = ioutil.WriteFile(path, data, 0644)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	listed, err := files.GetInstalledPackages()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]PackageInfo{}
+	for _, info := range listed {
+		names[info.Name] = info
+	}
+
+	for _, name := range []string{"bash", "source.tar.gz", "source.tar.bz2", "unreadable.file"} {
+		if _, ok := names[name]; !ok {
+			t.Errorf("Expected '%s' to be listed but got %v", name, listed)
+		}
+	}
+
+	if len(listed) != 4 {
+		t.Errorf("Expected 4 packages but got %d", len(listed))
+	}
+
+	if duplicates := files.Duplicates(); len(duplicates) != 1 {
+		t.Errorf("Expected one duplicate file but got %v", duplicates)
+	}
+
+	_, err = files.Get(names["bash"])
+
+	if err == nil {
+		t.Error("Expected getting a duplicated package to fail")
+	}
+
+	_, err = files.Get(names["unreadable.file"])
+
+	if err == nil {
+		t.Error("Expected getting an unreadable file to fail")
+	}
+
+	pack, err := files.Get(names["source.tar.bz2"])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(pack.Data) != "bzipped source" {
+		t.Errorf("Expected the bz2 file but got '%s'", pack.Data)
+	}
+}
@@ -0,0 +1,139 @@
+package pkgthing
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GarbageCollector unpins blobs that no row in the given systems references.
+// Snapshots in the Snapshots index and entries in Log, when set, are kept.
+// Other pins that pkgthing did not create must be listed in Keep.
+type GarbageCollector struct {
+	Searcher  PackageSearcher
+	Store     PinningStorage
+	Systems   []string
+	Keep      []string
+	Snapshots SnapshotIndex
+	Log       *TransparencyLog
+}
+
+func (collector GarbageCollector) Collect(dryRun bool) ([]string, error) {
+	const errMsg = "Collect failed"
+
+	if len(collector.Systems) == 0 {
+		return nil, errors.New("No systems to collect")
+	}
+
+	referenced, err := collector.referencedPaths()
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	pins, err := collector.Store.Pins()
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	garbage := []string{}
+	for _, hash := range pins {
+		if referenced[normalizeHash(hash)] {
+			continue
+		}
+
+		garbage = append(garbage, hash)
+	}
+
+	if dryRun {
+		return garbage, nil
+	}
+
+	for _, hash := range garbage {
+		err := collector.Store.Unpin(hash)
+
+		if err != nil {
+			return nil, errors.Wrap(err, errMsg)
+		}
+	}
+
+	return garbage, nil
+}
+
+func (collector GarbageCollector) referencedPaths() (map[string]bool, error) {
+	referenced := map[string]bool{}
+
+	for _, hash := range collector.Keep {
+		referenced[normalizeHash(hash)] = true
+	}
+
+	if collector.Snapshots != nil {
+		snapshots, err := collector.Snapshots.Snapshots()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hash := range snapshots {
+			referenced[normalizeHash(hash)] = true
+		}
+	}
+
+	if collector.Log != nil {
+		entries, _, err := collector.Log.Walk()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			referenced[normalizeHash(entry.Hash)] = true
+		}
+	}
+
+	for _, system := range collector.Systems {
+		lister := SystemLister{
+			Searcher: collector.Searcher,
+			System:   system,
+		}
+
+		allInfo, err := lister.GetAllCandidates()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range allInfo {
+			referenced[normalizeHash(info.IpfsPath)] = true
+
+			for _, entry := range info.MetaData {
+				if entry.MetaDataKey == DELTA_PATH_KEY {
+					referenced[normalizeHash(entry.MetaDataValue)] = true
+				}
+			}
+
+			if !isChunked(info) {
+				continue
+			}
+
+			hashes, err := chunkHashes(collector.Store, info.IpfsPath)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, hash := range hashes {
+				referenced[normalizeHash(hash)] = true
+			}
+		}
+	}
+
+	return referenced, nil
+}
+
+func normalizeHash(hash string) string {
+	return strings.TrimPrefix(hash, __IPFS_PATH_PREFIX)
+}
+
+const __IPFS_PATH_PREFIX = "/ipfs/"
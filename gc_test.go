@@ -0,0 +1,78 @@
+package pkgthing
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGarbageCollectorKeepsSavedSnapshots(t *testing.T) {
+	store := makeMemoryStorage()
+
+	packagePath, err := store.Add(bytes.NewReader(testRandomData(1, 1024)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphanPath, err := store.Add(bytes.NewReader(testRandomData(2, 1024)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	info.IpfsPath = packagePath
+
+	index := &memorySnapshotIndex{}
+	snapshotPath, err := SaveSnapshot(store, index, Snapshot{Packages: []PackageInfo{info}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collector := GarbageCollector{
+		Searcher:  &fakeSearcher{found: []PackageInfo{info}},
+		Store:     store,
+		Systems:   []string{"ubuntu"},
+		Snapshots: index,
+	}
+
+	garbage, err := collector.Collect(false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(garbage) != 1 || garbage[0] != orphanPath {
+		t.Errorf("Expected only the orphan to be collected but got %v", garbage)
+	}
+
+	pins, err := store.Pins()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := map[string]bool{}
+	for _, hash := range pins {
+		kept[hash] = true
+	}
+
+	if !kept[snapshotPath] || !kept[packagePath] {
+		t.Errorf("Expected the snapshot and package to stay pinned but have %v", pins)
+	}
+}
+
+// memorySnapshotIndex is a SnapshotIndex kept in memory.
+type memorySnapshotIndex struct {
+	hashes []string
+}
+
+func (index *memorySnapshotIndex) AddSnapshot(hash string) error {
+	index.hashes = append(index.hashes, hash)
+	return nil
+}
+
+func (index *memorySnapshotIndex) Snapshots() ([]string, error) {
+	return index.hashes, nil
+}
@@ -1,8 +1,9 @@
 package pkgthing
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
+	"sort"
 
 	"github.com/johnny-morrice/godless/api"
 	"github.com/johnny-morrice/godless/crdt"
@@ -29,24 +30,63 @@ func (builder *addBuilder) buildQuery() (*query.Query, error) {
 	entries := map[crdt.EntryName]crdt.PointText{
 		__DATAPATH_KEY: crdt.PointText(builder.pack.IpfsPath),
 	}
-	row := query.QueryRowJoin{
-		RowKey:  crdt.RowName(rowKey),
-		Entries: entries,
-	}
 
 	for _, meta := range builder.pack.MetaData {
 		key := metaKey(meta.MetaDataKey)
 		entries[key] = crdt.PointText(meta.MetaDataValue)
 	}
 
-	q := &query.Query{
+	publication, err := json.Marshal(makePublication(builder.pack.PackageInfo))
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries[__PUBLICATION_KEY] = crdt.PointText(publication)
+
+	return joinQuery(table, rowKey, entries), nil
+}
+
+// recordBuilder adds a JSON record, such as a Yank, to a package row.
+type recordBuilder struct {
+	info   PackageInfo
+	key    crdt.EntryName
+	record interface{}
+}
+
+func (builder *recordBuilder) setRecord(info PackageInfo, key crdt.EntryName, record interface{}) {
+	builder.info = info
+	builder.key = key
+	builder.record = record
+}
+
+func (builder *recordBuilder) buildQuery() (*query.Query, error) {
+	text, err := json.Marshal(builder.record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[crdt.EntryName]crdt.PointText{
+		builder.key: crdt.PointText(text),
+	}
+
+	return joinQuery(systemTable(builder.info.System), builder.info.Name, entries), nil
+}
+
+func joinQuery(table, rowKey string, entries map[crdt.EntryName]crdt.PointText) *query.Query {
+	row := query.QueryRowJoin{
+		RowKey:  crdt.RowName(rowKey),
+		Entries: entries,
+	}
+
+	return &query.Query{
 		OpCode:   query.JOIN,
 		TableKey: crdt.TableName(table),
 		Join: query.QueryJoin{
 			Rows: []query.QueryRowJoin{row},
 		},
 	}
-	return q, nil
 }
 
 type getBuilder struct {
@@ -90,61 +130,175 @@ func (builder *searchBuilder) nameWildcardQuery() (*query.Query, error) {
 	return query.Compile("select ?? where str_glob(@key, ?)", systemTable(builder.term.System), builder.term.SearchTerm)
 }
 
-func readPackage(resp api.Response) (Package, error) {
-	info, err := readPackageInfo(resp)
+// readPackageInfo reads every candidate in the response. Only yanks signed by
+// the publisher or by one of yankers are kept.
+func readPackageInfo(resp api.Response, yankers []KeyReference, logger Logger) ([]PackageInfo, error) {
+	allInfo := []PackageInfo{}
 
-	log.Print("Read package info")
+	resp.Namespace.ForeachRow(func(t crdt.TableName, r crdt.RowName, row crdt.Row) {
+		// TODO return the error
+		system, err := readSystemTableName(t)
 
-	if err != nil {
-		return Package{}, err
-	}
+		if err != nil {
+			return
+		}
 
-	if len(info) != 1 {
-		return Package{}, fmt.Errorf("Expected exactly 1 PackageInfo but received: %d", len(info))
-	}
+		dataentry, err := row.GetEntry(__DATAPATH_KEY)
 
-	pack := Package{
-		PackageInfo: info[0],
-	}
+		if err != nil {
+			return
+		}
 
-	return pack, nil
+		rowMetaData := readMetaData(row)
+		publications := readRowPublications(row, logger)
+		yanks := readRowYanks(row, logger)
+		attestations := readRowAttestations(row, logger)
+		promotions := readRowPromotions(row, logger)
+
+		// Each datapath is a separate candidate for the package, or several
+		// when it was published with different metadata.
+		for _, point := range dataentry.GetValues() {
+			row := PackageInfo{
+				System:   system,
+				Name:     string(r),
+				IpfsPath: string(point.Text()),
+				MetaData: rowMetaData,
+			}
+
+			for _, info := range publicationCandidates(row, publications[row.IpfsPath]) {
+				for _, yank := range yanks {
+					if yank.IpfsPath == info.IpfsPath && yank.isValid(info) && yank.isAuthorised(info, yankers) {
+						info.Yanks = append(info.Yanks, yank)
+					}
+				}
+
+				for _, attestation := range attestations {
+					if attestation.IpfsPath == info.IpfsPath && attestation.isValid(info) {
+						info.Attestations = append(info.Attestations, attestation)
+					}
+				}
+
+				applyPromotions(&info, promotions)
+
+				allInfo = append(allInfo, info)
+			}
+		}
+	})
+
+	return allInfo, nil
 }
 
-func readPackageInfo(resp api.Response) ([]PackageInfo, error) {
-	allInfo := []PackageInfo{}
+func readMetaData(row crdt.Row) []MetaDataEntry {
+	metadata := []MetaDataEntry{}
 
-	resp.Namespace.ForeachRow(func(t crdt.TableName, r crdt.RowName, row crdt.Row) {
-		// TODO return the error
-		system, err := readSystemTableName(t)
+	row.ForeachEntry(func(n crdt.EntryName, entry crdt.Entry) {
+		var key string
+		_, err := fmt.Sscanf(string(n), __META_DATA_PREFIX+"%s", &key)
 
 		if err != nil {
 			return
 		}
 
-		dataentry, err := row.GetEntry(__DATAPATH_KEY)
+		for _, point := range entry.GetValues() {
+			meta := MetaDataEntry{
+				MetaDataKey:   key,
+				MetaDataValue: string(point.Text()),
+			}
+			metadata = append(metadata, meta)
+		}
+	})
+
+	return metadata
+}
+
+func readRowPublications(row crdt.Row, logger Logger) map[string][]Publication {
+	publications := map[string][]Publication{}
+
+	forEachPoint(row, __PUBLICATION_KEY, func(text []byte) {
+		pub := Publication{}
+		err := json.Unmarshal(text, &pub)
+
+		if err != nil {
+			logger.Log(LOG_WARN, "Bad publication record", errorField(err))
+			return
+		}
+
+		publications[pub.IpfsPath] = append(publications[pub.IpfsPath], pub)
+	})
+
+	for _, pubs := range publications {
+		sort.SliceStable(pubs, func(i, j int) bool {
+			return pubs[i].Time.Before(pubs[j].Time)
+		})
+	}
+
+	return publications
+}
+
+func readRowYanks(row crdt.Row, logger Logger) []Yank {
+	yanks := []Yank{}
+
+	forEachPoint(row, __YANKED_KEY, func(text []byte) {
+		yank := Yank{}
+		err := json.Unmarshal(text, &yank)
 
 		if err != nil {
+			logger.Log(LOG_WARN, "Bad yank record", errorField(err))
 			return
 		}
 
-		points := dataentry.GetValues()
+		yanks = append(yanks, yank)
+	})
+
+	return yanks
+}
+
+func readRowAttestations(row crdt.Row, logger Logger) []Attestation {
+	attestations := []Attestation{}
 
-		if len(points) != 1 {
+	forEachPoint(row, __ATTESTATION_KEY, func(text []byte) {
+		attestation := Attestation{}
+		err := json.Unmarshal(text, &attestation)
+
+		if err != nil {
+			logger.Log(LOG_WARN, "Bad attestation record", errorField(err))
 			return
 		}
 
-		datapath := points[0].Text()
+		attestations = append(attestations, attestation)
+	})
+
+	return attestations
+}
+
+func readRowPromotions(row crdt.Row, logger Logger) []Promotion {
+	promotions := []Promotion{}
 
-		info := PackageInfo{
-			System:   system,
-			Name:     string(r),
-			IpfsPath: string(datapath),
+	forEachPoint(row, __PROMOTION_KEY, func(text []byte) {
+		promotion := Promotion{}
+		err := json.Unmarshal(text, &promotion)
+
+		if err != nil {
+			logger.Log(LOG_WARN, "Bad promotion record", errorField(err))
+			return
 		}
 
-		allInfo = append(allInfo, info)
+		promotions = append(promotions, promotion)
 	})
 
-	return allInfo, nil
+	return promotions
+}
+
+func forEachPoint(row crdt.Row, key crdt.EntryName, f func(text []byte)) {
+	entry, err := row.GetEntry(key)
+
+	if err != nil {
+		return
+	}
+
+	for _, point := range entry.GetValues() {
+		f([]byte(point.Text()))
+	}
 }
 
 func readSystemTableName(tableName crdt.TableName) (string, error) {
@@ -178,3 +332,7 @@ func metaKey(metaDataKey string) crdt.EntryName {
 const __DATAPATH_KEY = "datapath"
 const __SYSTEM_TABLE_PREFIX = "system_"
 const __META_DATA_PREFIX = "meta_"
+const __YANKED_KEY = "yanked"
+const __PUBLICATION_KEY = "publication"
+const __ATTESTATION_KEY = "attestation"
+const __PROMOTION_KEY = "promotion"
@@ -2,16 +2,20 @@ package pkgthing
 
 import (
 	"io"
-	"log"
 
 	ipfs "github.com/ipfs/go-ipfs-api"
 	godless "github.com/johnny-morrice/godless/api"
 	"github.com/johnny-morrice/godless/http"
 )
 
-func MakeIpfsStorage(url string) ContentAddressableStorage {
+func MakeIpfsStorage(url string) PinningStorage {
+	return MakeLoggingIpfsStorage(url, nil)
+}
+
+func MakeLoggingIpfsStorage(url string, logger Logger) PinningStorage {
 	return ipfsShell{
-		ipfs: ipfs.NewShell(url),
+		ipfs:   ipfs.NewShell(url),
+		logger: useLogger(logger),
 	}
 }
 
@@ -24,24 +28,64 @@ func MakeRemoteGodlessClient(url string) (godless.Client, error) {
 }
 
 type ipfsShell struct {
-	ipfs *ipfs.Shell
+	ipfs   *ipfs.Shell
+	logger Logger
 }
 
 func (shell ipfsShell) Cat(hash string) (io.ReadCloser, error) {
-	log.Printf("Catting data from IPFS: '%s'", hash)
+	shell.logger.Log(LOG_DEBUG, "Catting data from IPFS", LogField{Key: "hash", Value: hash})
 
 	return shell.ipfs.Cat(hash)
 }
 
 func (shell ipfsShell) Add(r io.Reader) (string, error) {
-	log.Printf("Adding data to IPFS...")
+	shell.logger.Log(LOG_DEBUG, "Adding data to IPFS")
 	hash, err := shell.ipfs.Add(r)
 
 	if err != nil {
 		return "", err
 	}
 
-	log.Printf("Added data to IPFS at: '%s'", hash)
+	shell.logger.Log(LOG_DEBUG, "Added data to IPFS", LogField{Key: "hash", Value: hash})
+
+	err = shell.Pin(hash)
+
+	if err != nil {
+		return "", err
+	}
 
 	return hash, nil
 }
+
+func (shell ipfsShell) Pin(hash string) error {
+	shell.logger.Log(LOG_DEBUG, "Pinning IPFS data", LogField{Key: "hash", Value: hash})
+
+	return shell.ipfs.Pin(hash)
+}
+
+func (shell ipfsShell) Unpin(hash string) error {
+	shell.logger.Log(LOG_DEBUG, "Unpinning IPFS data", LogField{Key: "hash", Value: hash})
+
+	return shell.ipfs.Unpin(hash)
+}
+
+func (shell ipfsShell) Pins() ([]string, error) {
+	pins, err := shell.ipfs.Pins()
+
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(pins))
+	for hash, info := range pins {
+		if info.Type != __IPFS_RECURSIVE_PIN {
+			continue
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, nil
+}
+
+const __IPFS_RECURSIVE_PIN = "recursive"
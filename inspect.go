@@ -0,0 +1,447 @@
+package pkgthing
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// InspectPackage fills in the name and metadata of a .deb or .rpm package from
+// the control data inside it. A name or metadata already set on the package
+// must agree with the file. Other files are returned unchanged.
+func InspectPackage(pack Package) (Package, error) {
+	const errMsg = "InspectPackage failed"
+
+	var found PackageInfo
+	var err error
+
+	switch {
+	case bytes.HasPrefix(pack.Data, []byte(__AR_MAGIC)):
+		found, err = inspectDeb(pack.Data)
+	case bytes.HasPrefix(pack.Data, []byte(__RPM_MAGIC)):
+		found, err = inspectRpm(pack.Data)
+	default:
+		return pack, nil
+	}
+
+	if err != nil {
+		return Package{}, errors.Wrap(err, errMsg)
+	}
+
+	if pack.Name == "" {
+		pack.Name = found.Name
+	} else if found.Name != "" && pack.Name != found.Name {
+		return Package{}, fmt.Errorf("%s: Name is '%s' but file says '%s'", errMsg, pack.Name, found.Name)
+	}
+
+	for _, entry := range found.MetaData {
+		given := pack.GetMetaData(entry.MetaDataKey)
+
+		if given != "" && given != entry.MetaDataValue {
+			return Package{}, fmt.Errorf("%s: %s is '%s' but file says '%s'", errMsg, entry.MetaDataKey, given, entry.MetaDataValue)
+		}
+
+		pack.PackageInfo = pack.withMetaData(entry.MetaDataKey, entry.MetaDataValue)
+	}
+
+	return pack, nil
+}
+
+func inspectDeb(data []byte) (PackageInfo, error) {
+	members, err := readAr(data)
+
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	for name, member := range members {
+		if !strings.HasPrefix(name, __DEB_CONTROL_MEMBER) {
+			continue
+		}
+
+		control, err := readDebControl(name, member)
+
+		if err != nil {
+			return PackageInfo{}, err
+		}
+
+		stanzas, err := ParseControl(bytes.NewReader(control))
+
+		if err != nil {
+			return PackageInfo{}, err
+		}
+
+		if len(stanzas) == 0 {
+			return PackageInfo{}, fmt.Errorf("Empty control file")
+		}
+
+		info := PackageInfo{
+			Name: stanzas[0].Get("Package"),
+		}
+
+		info = stanzas[0].controlMetaData(info)
+		info = info.withMetaData(FORMAT_KEY, DEB_FORMAT)
+		return info, nil
+	}
+
+	return PackageInfo{}, fmt.Errorf("No %s member in deb", __DEB_CONTROL_MEMBER)
+}
+
+// readAr returns the members of an ar archive by name.
+func readAr(data []byte) (map[string][]byte, error) {
+	members := map[string][]byte{}
+
+	offset := len(__AR_MAGIC)
+	for offset+__AR_HEADER_SIZE <= len(data) {
+		name, size, err := readArHeader(data[offset:offset+__AR_HEADER_SIZE], offset)
+		offset += __AR_HEADER_SIZE
+
+		if err != nil {
+			return nil, err
+		}
+
+		if offset+size > len(data) {
+			return nil, fmt.Errorf("Bad size for ar member '%s'", name)
+		}
+
+		members[name] = data[offset : offset+size]
+		offset += size + size%2
+	}
+
+	return members, nil
+}
+
+func readArHeader(header []byte, offset int) (string, int, error) {
+	if string(header[58:60]) != __AR_HEADER_END {
+		return "", 0, fmt.Errorf("Bad ar header at %d", offset)
+	}
+
+	name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+	size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+
+	if err != nil || size < 0 {
+		return "", 0, fmt.Errorf("Bad size for ar member '%s'", name)
+	}
+
+	return name, size, nil
+}
+
+// readPackageHeader reads the start of a package file, up to the end of the
+// control data InspectPackage needs, so that a file can be inspected without
+// reading its contents. Other files are not read beyond their magic.
+func readPackageHeader(r io.ReaderAt, size int64) ([]byte, error) {
+	magic, err := readPrefix(r, size, int64(len(__AR_MAGIC)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var end int64
+
+	switch {
+	case bytes.HasPrefix(magic, []byte(__AR_MAGIC)):
+		end, err = debHeaderEnd(r, size)
+	case bytes.HasPrefix(magic, []byte(__RPM_MAGIC)):
+		end, err = rpmHeaderEnd(r, size)
+	default:
+		return magic, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readPrefix(r, size, end)
+}
+
+// debHeaderEnd finds the end of the control member, which comes before the
+// data member in a deb.
+func debHeaderEnd(r io.ReaderAt, size int64) (int64, error) {
+	offset := int64(len(__AR_MAGIC))
+
+	for offset+__AR_HEADER_SIZE <= size {
+		header, err := readPrefix(io.NewSectionReader(r, offset, __AR_HEADER_SIZE), __AR_HEADER_SIZE, __AR_HEADER_SIZE)
+
+		if err != nil {
+			return 0, err
+		}
+
+		name, memberSize, err := readArHeader(header, int(offset))
+
+		if err != nil {
+			return 0, err
+		}
+
+		end := offset + __AR_HEADER_SIZE + int64(memberSize)
+
+		if strings.HasPrefix(name, __DEB_CONTROL_MEMBER) {
+			return end, nil
+		}
+
+		offset = end + int64(memberSize%2)
+	}
+
+	return size, nil
+}
+
+// rpmHeaderEnd finds the end of the main header, which follows the lead and
+// the signature header.
+func rpmHeaderEnd(r io.ReaderAt, size int64) (int64, error) {
+	next, err := rpmHeaderSpan(r, size, __RPM_LEAD_SIZE)
+
+	if err != nil {
+		return 0, err
+	}
+
+	next += (8 - next%8) % 8
+	return rpmHeaderSpan(r, size, next)
+}
+
+func rpmHeaderSpan(r io.ReaderAt, size, offset int64) (int64, error) {
+	intro, err := readPrefix(io.NewSectionReader(r, offset, 16), 16, 16)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(intro) < 16 {
+		return size, nil
+	}
+
+	count := int64(binary.BigEndian.Uint32(intro[8:]))
+	store := int64(binary.BigEndian.Uint32(intro[12:]))
+	return offset + 16 + count*16 + store, nil
+}
+
+// readPrefix reads up to n bytes from the start of r, which is size bytes.
+func readPrefix(r io.ReaderAt, size, n int64) ([]byte, error) {
+	if n > size {
+		n = size
+	}
+
+	prefix := make([]byte, n)
+	read, err := r.ReadAt(prefix, 0)
+
+	if err == io.EOF {
+		err = nil
+	}
+
+	return prefix[:read], err
+}
+
+func readDebControl(name string, member []byte) ([]byte, error) {
+	var archive []byte
+	var err error
+
+	switch path.Ext(name) {
+	case ".tar":
+		archive = member
+	case ".gz":
+		var reader *gzip.Reader
+		reader, err = gzip.NewReader(bytes.NewReader(member))
+
+		if err == nil {
+			archive, err = ioutil.ReadAll(reader)
+		}
+	case ".xz":
+		archive, err = decompressData(XZ_COMPRESSION, member)
+	case ".zst":
+		archive, err = decompressData(ZSTD_COMPRESSION, member)
+	default:
+		err = fmt.Errorf("Unknown compression for '%s'", name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := reader.Next()
+
+		if err == io.EOF {
+			return nil, fmt.Errorf("No control file in '%s'", name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if path.Clean(header.Name) == __DEB_CONTROL_FILE {
+			return ioutil.ReadAll(reader)
+		}
+	}
+}
+
+func inspectRpm(data []byte) (PackageInfo, error) {
+	if len(data) < __RPM_LEAD_SIZE {
+		return PackageInfo{}, fmt.Errorf("Truncated rpm lead")
+	}
+
+	// The signature header is padded to 8 bytes, the main header is not.
+	_, next, err := readRpmHeader(data, __RPM_LEAD_SIZE)
+
+	if err != nil {
+		return PackageInfo{}, errors.Wrap(err, "Bad rpm signature header")
+	}
+
+	next += (8 - next%8) % 8
+	tags, _, err := readRpmHeader(data, next)
+
+	if err != nil {
+		return PackageInfo{}, errors.Wrap(err, "Bad rpm header")
+	}
+
+	info := PackageInfo{
+		Name: tags.text(__RPMTAG_NAME),
+	}
+
+	version := tags.text(__RPMTAG_VERSION)
+	if release := tags.text(__RPMTAG_RELEASE); release != "" {
+		version += "-" + release
+	}
+
+	if epoch, ok := tags.number(__RPMTAG_EPOCH); ok {
+		version = fmt.Sprintf("%d:%s", epoch, version)
+	}
+
+	metadata := []MetaDataEntry{
+		{MetaDataKey: VERSION_KEY, MetaDataValue: version},
+		{MetaDataKey: ARCHITECTURE_KEY, MetaDataValue: tags.text(__RPMTAG_ARCH)},
+		{MetaDataKey: SUMMARY_KEY, MetaDataValue: tags.text(__RPMTAG_SUMMARY)},
+		{MetaDataKey: DESCRIPTION_KEY, MetaDataValue: tags.text(__RPMTAG_DESCRIPTION)},
+		{MetaDataKey: LICENSE_KEY, MetaDataValue: tags.text(__RPMTAG_LICENSE)},
+		{MetaDataKey: HOMEPAGE_KEY, MetaDataValue: tags.text(__RPMTAG_URL)},
+		{MetaDataKey: DEPENDS_KEY, MetaDataValue: strings.Join(tags.list(__RPMTAG_REQUIRENAME), ", ")},
+		{MetaDataKey: PROVIDES_KEY, MetaDataValue: strings.Join(tags.list(__RPMTAG_PROVIDENAME), ", ")},
+		{MetaDataKey: FORMAT_KEY, MetaDataValue: RPM_FORMAT},
+	}
+
+	for _, entry := range metadata {
+		if entry.MetaDataValue != "" {
+			info = info.withMetaData(entry.MetaDataKey, entry.MetaDataValue)
+		}
+	}
+
+	return info, nil
+}
+
+type rpmTags map[uint32][]string
+
+func (tags rpmTags) text(tag uint32) string {
+	values := tags[tag]
+
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func (tags rpmTags) list(tag uint32) []string {
+	return tags[tag]
+}
+
+func (tags rpmTags) number(tag uint32) (int, bool) {
+	n, err := strconv.Atoi(tags.text(tag))
+	return n, err == nil
+}
+
+// readRpmHeader reads the string and int32 tags of the header at offset,
+// returning them with the offset just past the header.
+func readRpmHeader(data []byte, offset int) (rpmTags, int, error) {
+	if offset+16 > len(data) || !bytes.Equal(data[offset:offset+3], []byte(__RPM_HEADER_MAGIC)) {
+		return nil, 0, fmt.Errorf("Missing header magic at %d", offset)
+	}
+
+	count := int(binary.BigEndian.Uint32(data[offset+8:]))
+	size := int(binary.BigEndian.Uint32(data[offset+12:]))
+	index := offset + 16
+	store := index + count*16
+	end := store + size
+
+	if count < 0 || size < 0 || store < index || end < store || end > len(data) {
+		return nil, 0, fmt.Errorf("Truncated header at %d", offset)
+	}
+
+	tags := rpmTags{}
+	for i := 0; i < count; i++ {
+		entry := data[index+i*16:]
+		tag := binary.BigEndian.Uint32(entry[0:])
+		kind := binary.BigEndian.Uint32(entry[4:])
+		at := int(binary.BigEndian.Uint32(entry[8:]))
+		n := int(binary.BigEndian.Uint32(entry[12:]))
+
+		if at < 0 || at >= size {
+			continue
+		}
+
+		values := data[store+at : end]
+		switch kind {
+		case __RPM_INT32_TYPE:
+			if n > 0 && len(values) >= 4 {
+				tags[tag] = []string{strconv.Itoa(int(int32(binary.BigEndian.Uint32(values))))}
+			}
+		case __RPM_STRING_TYPE, __RPM_STRING_ARRAY_TYPE, __RPM_I18NSTRING_TYPE:
+			if kind != __RPM_STRING_ARRAY_TYPE {
+				n = 1
+			}
+
+			for j := 0; j < n; j++ {
+				nul := bytes.IndexByte(values, 0)
+
+				if nul < 0 {
+					break
+				}
+
+				tags[tag] = append(tags[tag], string(values[:nul]))
+				values = values[nul+1:]
+			}
+		}
+	}
+
+	return tags, end, nil
+}
+
+const FORMAT_KEY = "format"
+const DEB_FORMAT = "deb"
+const RPM_FORMAT = "rpm"
+const SUMMARY_KEY = "summary"
+const DESCRIPTION_KEY = "description"
+const LICENSE_KEY = "license"
+const HOMEPAGE_KEY = "homepage"
+const DEPENDS_KEY = "depends"
+const PROVIDES_KEY = "provides"
+
+const __AR_MAGIC = "!<arch>\n"
+const __AR_HEADER_SIZE = 60
+const __AR_HEADER_END = "`\n"
+const __DEB_CONTROL_MEMBER = "control.tar"
+const __DEB_CONTROL_FILE = "control"
+const __RPM_MAGIC = "\xed\xab\xee\xdb"
+const __RPM_HEADER_MAGIC = "\x8e\xad\xe8"
+const __RPM_LEAD_SIZE = 96
+const __RPM_INT32_TYPE = 4
+const __RPM_STRING_TYPE = 6
+const __RPM_STRING_ARRAY_TYPE = 8
+const __RPM_I18NSTRING_TYPE = 9
+const __RPMTAG_NAME = 1000
+const __RPMTAG_VERSION = 1001
+const __RPMTAG_RELEASE = 1002
+const __RPMTAG_EPOCH = 1003
+const __RPMTAG_SUMMARY = 1004
+const __RPMTAG_DESCRIPTION = 1005
+const __RPMTAG_LICENSE = 1014
+const __RPMTAG_URL = 1020
+const __RPMTAG_ARCH = 1022
+const __RPMTAG_PROVIDENAME = 1047
+const __RPMTAG_REQUIRENAME = 1049
@@ -0,0 +1,196 @@
+package pkgthing
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestInspectDeb(t *testing.T) {
+	deb := testDeb(t, "bash", "4.4-1", "amd64", []byte("bash data"))
+
+	pack, err := InspectPackage(Package{Data: deb})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertInspected(t, pack.PackageInfo, "bash", "4.4-1", "amd64", DEB_FORMAT)
+
+	_, err = InspectPackage(Package{PackageInfo: PackageInfo{Name: "vim"}, Data: deb})
+
+	if err == nil {
+		t.Error("Expected a name that disagrees with the file to fail")
+	}
+}
+
+func TestInspectRpm(t *testing.T) {
+	rpm := testRpm("bash", "4.4", "1", "x86_64", []byte("bash data"))
+
+	pack, err := InspectPackage(Package{Data: rpm})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertInspected(t, pack.PackageInfo, "bash", "4.4-1", "x86_64", RPM_FORMAT)
+}
+
+func TestReadPackageHeader(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 64*1024)
+
+	for _, file := range [][]byte{
+		testDeb(t, "bash", "4.4-1", "amd64", data),
+		testRpm("bash", "4.4", "1", "x86_64", data),
+	} {
+		header, err := readPackageHeader(bytes.NewReader(file), int64(len(file)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(header) > len(file)-len(data) {
+			t.Errorf("Expected the header to stop before the data but read %d of %d bytes", len(header), len(file))
+		}
+
+		pack, err := InspectPackage(Package{Data: header})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pack.Name != "bash" {
+			t.Errorf("Expected header to name bash but got '%s'", pack.Name)
+		}
+	}
+
+	other := []byte("just some text that is not a package")
+	header, err := readPackageHeader(bytes.NewReader(other), int64(len(other)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(header) > len(__AR_MAGIC) {
+		t.Errorf("Expected only the magic of another file to be read but read %d bytes", len(header))
+	}
+}
+
+func assertInspected(t *testing.T, info PackageInfo, name, version, arch, format string) {
+	t.Helper()
+
+	if info.Name != name {
+		t.Errorf("Expected name '%s' but got '%s'", name, info.Name)
+	}
+
+	expected := map[string]string{
+		VERSION_KEY:      version,
+		ARCHITECTURE_KEY: arch,
+		FORMAT_KEY:       format,
+	}
+
+	for key, value := range expected {
+		if actual := info.GetMetaData(key); actual != value {
+			t.Errorf("Expected %s '%s' but got '%s'", key, value, actual)
+		}
+	}
+}
+
+// testDeb builds a deb with a gzipped control member and data appended raw.
+func testDeb(t *testing.T, name, version, arch string, data []byte) []byte {
+	t.Helper()
+
+	control := fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: %s\nDescription: test\n", name, version, arch)
+
+	archive := &bytes.Buffer{}
+	writer := tar.NewWriter(archive)
+	err := writer.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control))})
+
+	if err == nil {
+		_, err = writer.Write([]byte(control))
+	}
+
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, err := gzipData(archive.Bytes())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deb := &bytes.Buffer{}
+	deb.WriteString(__AR_MAGIC)
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", compressed},
+		{"data.tar", data},
+	} {
+		fmt.Fprintf(deb, "%-16s%-12s%-6s%-6s%-8s%-10d%s", member.name+"/", "0", "0", "0", "100644", len(member.data), __AR_HEADER_END)
+		deb.Write(member.data)
+
+		if len(member.data)%2 == 1 {
+			deb.WriteByte('\n')
+		}
+	}
+
+	return deb.Bytes()
+}
+
+// testRpm builds an rpm with an empty signature header and string tags.
+func testRpm(name, version, release, arch string, data []byte) []byte {
+	rpm := &bytes.Buffer{}
+
+	lead := make([]byte, __RPM_LEAD_SIZE)
+	copy(lead, __RPM_MAGIC)
+	rpm.Write(lead)
+
+	rpm.Write(testRpmHeader(nil))
+
+	tags := map[uint32]string{
+		__RPMTAG_NAME:    name,
+		__RPMTAG_VERSION: version,
+		__RPMTAG_RELEASE: release,
+		__RPMTAG_ARCH:    arch,
+	}
+	rpm.Write(testRpmHeader(tags))
+	rpm.Write(data)
+
+	return rpm.Bytes()
+}
+
+func testRpmHeader(tags map[uint32]string) []byte {
+	index := &bytes.Buffer{}
+	store := &bytes.Buffer{}
+
+	for _, tag := range []uint32{__RPMTAG_NAME, __RPMTAG_VERSION, __RPMTAG_RELEASE, __RPMTAG_ARCH} {
+		value, ok := tags[tag]
+
+		if !ok {
+			continue
+		}
+
+		binary.Write(index, binary.BigEndian, []uint32{tag, __RPM_STRING_TYPE, uint32(store.Len()), 1})
+		store.WriteString(value)
+		store.WriteByte(0)
+	}
+
+	header := &bytes.Buffer{}
+	header.WriteString(__RPM_HEADER_MAGIC)
+	header.Write([]byte{1, 0, 0, 0, 0})
+	binary.Write(header, binary.BigEndian, []uint32{uint32(index.Len() / 16), uint32(store.Len())})
+	header.Write(index.Bytes())
+	header.Write(store.Bytes())
+
+	return header.Bytes()
+}
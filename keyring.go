@@ -0,0 +1,373 @@
+package pkgthing
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Keyring holds the user's own signing keys, the public keys of other
+// publishers, and the TrustPolicy used to check package signatures.
+type Keyring struct {
+	Keys    []KeyringEntry
+	Default string
+	Policy  TrustPolicy
+}
+
+type KeyringEntry struct {
+	Name    string
+	Public  string
+	Private string `json:",omitempty"`
+}
+
+func (entry KeyringEntry) Reference() KeyReference {
+	ref, _ := ParseKeyReference(entry.Public)
+	return ref
+}
+
+func ReadKeyring(path string) (Keyring, error) {
+	const errMsg = "ReadKeyring failed"
+
+	text, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return Keyring{}, nil
+	}
+
+	if err != nil {
+		return Keyring{}, errors.Wrap(err, errMsg)
+	}
+
+	keyring := Keyring{}
+	err = json.Unmarshal(text, &keyring)
+
+	if err != nil {
+		return Keyring{}, errors.Wrap(err, errMsg)
+	}
+
+	return keyring, nil
+}
+
+func WriteKeyring(path string, keyring Keyring) error {
+	const errMsg = "WriteKeyring failed"
+
+	text, err := json.MarshalIndent(keyring, "", "  ")
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), __KEY_DIR_MODE)
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	err = ioutil.WriteFile(path, text, __KEY_FILE_MODE)
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	return nil
+}
+
+func (keyring *Keyring) Generate(name string) (Ed25519Key, error) {
+	key, err := GenerateEd25519Key()
+
+	if err != nil {
+		return Ed25519Key{}, err
+	}
+
+	entry := KeyringEntry{
+		Name:    name,
+		Public:  key.Reference().String(),
+		Private: hex.EncodeToString(key.Private.Seed()),
+	}
+
+	keyring.Keys = append(keyring.Keys, entry)
+
+	if keyring.Default == "" {
+		keyring.Default = entry.Public
+	}
+
+	return key, nil
+}
+
+func (keyring *Keyring) Import(name string, ref KeyReference) error {
+	if _, ok := keyring.find(ref.String()); ok {
+		return fmt.Errorf("Key already in keyring: %s", ref)
+	}
+
+	entry := KeyringEntry{
+		Name:   name,
+		Public: ref.String(),
+	}
+
+	keyring.Keys = append(keyring.Keys, entry)
+	return nil
+}
+
+func (keyring *Keyring) ImportPrivate(name string, key Ed25519Key) error {
+	ref := key.Reference()
+
+	if _, ok := keyring.find(ref.String()); ok {
+		return fmt.Errorf("Key already in keyring: %s", ref)
+	}
+
+	entry := KeyringEntry{
+		Name:    name,
+		Public:  ref.String(),
+		Private: hex.EncodeToString(key.Private.Seed()),
+	}
+
+	keyring.Keys = append(keyring.Keys, entry)
+
+	if keyring.Default == "" {
+		keyring.Default = entry.Public
+	}
+
+	return nil
+}
+
+func (keyring *Keyring) Lookup(fingerprint string) (KeyringEntry, error) {
+	entry, ok := keyring.find(fingerprint)
+
+	if !ok {
+		return KeyringEntry{}, fmt.Errorf("No such key: %s", fingerprint)
+	}
+
+	return entry, nil
+}
+
+func (keyring *Keyring) DefaultKey() (Ed25519Key, error) {
+	if keyring.Default == "" {
+		return Ed25519Key{}, errors.New("No default key")
+	}
+
+	entry, err := keyring.Lookup(keyring.Default)
+
+	if err != nil {
+		return Ed25519Key{}, err
+	}
+
+	return entry.PrivateKey()
+}
+
+// Trust adds the key to the rule for the system and name globs, creating the
+// rule if needed. A required count of 0 leaves an existing rule's count alone.
+func (keyring *Keyring) Trust(fingerprint, systemGlob, nameGlob string, required int) error {
+	if _, err := keyring.Lookup(fingerprint); err != nil {
+		return err
+	}
+
+	policy := &keyring.Policy
+	policy.Revoked = removeString(policy.Revoked, fingerprint)
+
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+
+		if rule.System != systemGlob || rule.Name != nameGlob {
+			continue
+		}
+
+		if !containsString(rule.Keys, fingerprint) {
+			rule.Keys = append(rule.Keys, fingerprint)
+		}
+
+		if required > 0 {
+			rule.Required = required
+		}
+
+		return nil
+	}
+
+	rule := TrustRule{
+		System:   systemGlob,
+		Name:     nameGlob,
+		Keys:     []string{fingerprint},
+		Required: required,
+	}
+
+	policy.Rules = append(policy.Rules, rule)
+	return nil
+}
+
+func (keyring *Keyring) Revoke(fingerprint string) error {
+	if _, err := keyring.Lookup(fingerprint); err != nil {
+		return err
+	}
+
+	policy := &keyring.Policy
+	for i := range policy.Rules {
+		policy.Rules[i].Keys = removeString(policy.Rules[i].Keys, fingerprint)
+	}
+
+	if !containsString(policy.Revoked, fingerprint) {
+		policy.Revoked = append(policy.Revoked, fingerprint)
+	}
+
+	if keyring.Default == fingerprint {
+		keyring.Default = ""
+	}
+
+	return nil
+}
+
+func (keyring *Keyring) TrustedKeys() []KeyReference {
+	seen := map[string]bool{}
+	keys := []KeyReference{}
+
+	for _, rule := range keyring.Policy.Rules {
+		for _, fingerprint := range rule.Keys {
+			if seen[fingerprint] {
+				continue
+			}
+
+			seen[fingerprint] = true
+
+			if ref, err := ParseKeyReference(fingerprint); err == nil {
+				keys = append(keys, ref)
+			}
+		}
+	}
+
+	return keys
+}
+
+func (keyring *Keyring) find(fingerprint string) (KeyringEntry, bool) {
+	for _, entry := range keyring.Keys {
+		if entry.Public == fingerprint || (entry.Name != "" && entry.Name == fingerprint) {
+			return entry, true
+		}
+	}
+
+	return KeyringEntry{}, false
+}
+
+func (entry KeyringEntry) PrivateKey() (Ed25519Key, error) {
+	if entry.Private == "" {
+		return Ed25519Key{}, fmt.Errorf("No private key for: %s", entry.Public)
+	}
+
+	seed, err := hex.DecodeString(entry.Private)
+
+	if err != nil {
+		return Ed25519Key{}, err
+	}
+
+	if len(seed) != ed25519.SeedSize {
+		return Ed25519Key{}, errors.New("Bad private key size")
+	}
+
+	return Ed25519Key{Private: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// TrustPolicy says which keys must sign which packages. A package must match
+// at least one rule, and every matching rule must be satisfied.
+type TrustPolicy struct {
+	Rules   []TrustRule
+	Revoked []string
+}
+
+type TrustRule struct {
+	System   string
+	Name     string
+	Keys     []string
+	Required int
+}
+
+func (policy TrustPolicy) IsEmpty() bool {
+	return len(policy.Rules) == 0
+}
+
+func (policy TrustPolicy) Check(info PackageInfo) error {
+	matched := false
+
+	for _, rule := range policy.Rules {
+		if !rule.matches(info) {
+			continue
+		}
+
+		matched = true
+
+		signers := policy.trustedSigners(rule, info)
+		if len(signers) < rule.required() {
+			return fmt.Errorf("Package '%s' on '%s' has %d of %d required trusted signatures", info.Name, info.System, len(signers), rule.required())
+		}
+	}
+
+	if !matched {
+		return fmt.Errorf("No trust rule for package '%s' on '%s'", info.Name, info.System)
+	}
+
+	return nil
+}
+
+func (policy TrustPolicy) trustedSigners(rule TrustRule, info PackageInfo) map[string]bool {
+	signers := map[string]bool{}
+
+	for _, sig := range info.Signatures {
+		fingerprint := sig.Fingerprint.String()
+
+		if containsString(policy.Revoked, fingerprint) {
+			continue
+		}
+
+		if containsString(rule.Keys, fingerprint) {
+			signers[fingerprint] = true
+		}
+	}
+
+	return signers
+}
+
+func (rule TrustRule) matches(info PackageInfo) bool {
+	return globMatch(rule.System, info.System) && globMatch(rule.Name, info.Name)
+}
+
+func (rule TrustRule) required() int {
+	if rule.Required < 1 {
+		return 1
+	}
+
+	return rule.Required
+}
+
+func globMatch(pattern, text string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	matched, err := path.Match(pattern, text)
+	return err == nil && matched
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func removeString(list []string, s string) []string {
+	kept := make([]string, 0, len(list))
+
+	for _, item := range list {
+		if item != s {
+			kept = append(kept, item)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,193 @@
+package pkgthing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+type Manifest struct {
+	Packages []ManifestEntry
+}
+
+type ManifestEntry struct {
+	System   string
+	Name     string
+	Version  string
+	IpfsPath string
+}
+
+type LockFile struct {
+	Packages []LockedPackage
+}
+
+type LockedPackage struct {
+	PackageInfo
+	Hash string
+}
+
+func ReadManifest(r io.Reader) (Manifest, error) {
+	manifest := Manifest{}
+	err := json.NewDecoder(r).Decode(&manifest)
+	return manifest, err
+}
+
+func ReadLockFile(r io.Reader) (LockFile, error) {
+	lock := LockFile{}
+	err := json.NewDecoder(r).Decode(&lock)
+	return lock, err
+}
+
+func WriteLockFile(w io.Writer, lock LockFile) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(lock)
+}
+
+type Locker struct {
+	Searcher PackageSearcher
+	Getter   PackageGetter
+	Policy   ConflictPolicy
+}
+
+func (locker Locker) Lock(manifest Manifest) (LockFile, error) {
+	const errMsg = "Lock failed"
+
+	lock := LockFile{
+		Packages: make([]LockedPackage, 0, len(manifest.Packages)),
+	}
+
+	for _, entry := range manifest.Packages {
+		info, err := locker.resolve(entry)
+
+		if err != nil {
+			return LockFile{}, errors.Wrap(err, errMsg)
+		}
+
+		pack, err := locker.Getter.Get(info)
+
+		if err != nil {
+			return LockFile{}, errors.Wrap(err, errMsg)
+		}
+
+		locked := LockedPackage{
+			PackageInfo: pack.PackageInfo,
+			Hash:        hashData(pack.Data),
+		}
+
+		lock.Packages = append(lock.Packages, locked)
+	}
+
+	return lock, nil
+}
+
+func (locker Locker) resolve(entry ManifestEntry) (PackageInfo, error) {
+	if entry.System == "" || entry.Name == "" {
+		return PackageInfo{}, fmt.Errorf("Manifest entry must have System and Name: %v", entry)
+	}
+
+	term := PackageSearchTerm{
+		SearchKey:  SEARCH_NAME,
+		SearchTerm: entry.Name,
+		System:     entry.System,
+	}
+
+	found, err := locker.Searcher.Search(term)
+
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	if entry.IpfsPath != "" {
+		return resolvePinnedEntry(entry, found), nil
+	}
+
+	matches := []PackageInfo{}
+	for _, info := range found {
+		if info.Name != entry.Name {
+			continue
+		}
+
+		if entry.Version != "" && !info.HasMetaData(VERSION_KEY, entry.Version) {
+			continue
+		}
+
+		matches = append(matches, info)
+	}
+
+	if len(matches) == 0 {
+		return PackageInfo{}, fmt.Errorf("No match for '%s' on '%s'", entry.Name, entry.System)
+	}
+
+	policy := locker.Policy
+	if policy == nil {
+		policy = NewestPolicy{}
+	}
+
+	return policy.Choose(matches)
+}
+
+// resolvePinnedEntry prefers the indexed PackageInfo, which carries the
+// storage metadata needed to read the blob back.
+func resolvePinnedEntry(entry ManifestEntry, found []PackageInfo) PackageInfo {
+	for _, info := range found {
+		if info.Name == entry.Name && info.IpfsPath == entry.IpfsPath {
+			return info
+		}
+	}
+
+	info := PackageInfo{
+		System:   entry.System,
+		Name:     entry.Name,
+		IpfsPath: entry.IpfsPath,
+	}
+
+	if entry.Version != "" {
+		info = info.withMetaData(VERSION_KEY, entry.Version)
+	}
+
+	return info
+}
+
+type Applier struct {
+	Getter    PackageGetter
+	Installer PackageInstaller
+}
+
+func (applier Applier) Apply(lock LockFile) error {
+	const errMsg = "Apply failed"
+
+	for _, locked := range lock.Packages {
+		if locked.IpfsPath == "" {
+			return fmt.Errorf("%s: no IpfsPath for '%s'", errMsg, locked.Name)
+		}
+
+		pack, err := applier.Getter.Get(locked.PackageInfo)
+
+		if err != nil {
+			return errors.Wrap(err, errMsg)
+		}
+
+		hash := hashData(pack.Data)
+		if hash != locked.Hash {
+			return fmt.Errorf("%s: hash mismatch for '%s': expected '%s' but received '%s'", errMsg, locked.Name, locked.Hash, hash)
+		}
+
+		err = applier.Installer.InstallPackage(pack)
+
+		if err != nil {
+			return errors.Wrap(err, errMsg)
+		}
+	}
+
+	return nil
+}
+
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,97 @@
+package pkgthing
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLockAndApply(t *testing.T) {
+	old := testPackageInfo("ubuntu", "bash", "4.3", "amd64")
+	old.IpfsPath = "old-path"
+	current := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	current.IpfsPath = "current-path"
+
+	getter := &fakeGetter{data: map[string][]byte{
+		"old-path":     []byte("old bash"),
+		"current-path": []byte("current bash"),
+	}}
+
+	locker := Locker{
+		Searcher: &fakeSearcher{found: []PackageInfo{old, current}},
+		Getter:   getter,
+	}
+
+	manifest := Manifest{Packages: []ManifestEntry{
+		{System: "ubuntu", Name: "bash"},
+		{System: "ubuntu", Name: "bash", Version: "4.3"},
+		{System: "ubuntu", Name: "bash", IpfsPath: "old-path"},
+	}}
+
+	lock, err := locker.Lock(manifest)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []string{"current-path", "old-path", "old-path"} {
+		if lock.Packages[i].IpfsPath != expected {
+			t.Errorf("Expected entry %d to lock '%s' but got '%s'", i, expected, lock.Packages[i].IpfsPath)
+		}
+	}
+
+	buff := &bytes.Buffer{}
+	err = WriteLockFile(buff, lock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err = ReadLockFile(buff)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	installer := &fakeInstaller{}
+	applier := Applier{Getter: getter, Installer: installer}
+	err = applier.Apply(lock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(installer.installed) != 3 {
+		t.Errorf("Expected 3 installs but got %d", len(installer.installed))
+	}
+
+	getter.data["old-path"] = []byte("tampered bash")
+	err = applier.Apply(lock)
+
+	if err == nil {
+		t.Error("Expected a hash mismatch to fail")
+	}
+}
+
+func TestLockRejectsMissingPackages(t *testing.T) {
+	locker := Locker{Searcher: &fakeSearcher{}, Getter: &fakeGetter{}}
+
+	for _, entry := range []ManifestEntry{
+		{Name: "bash"},
+		{System: "ubuntu", Name: "bash"},
+	} {
+		_, err := locker.Lock(Manifest{Packages: []ManifestEntry{entry}})
+
+		if err == nil {
+			t.Errorf("Expected %v to fail", entry)
+		}
+	}
+}
+
+type fakeInstaller struct {
+	installed []Package
+}
+
+func (installer *fakeInstaller) InstallPackage(pack Package) error {
+	installer.installed = append(installer.installed, pack)
+	return nil
+}
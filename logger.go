@@ -0,0 +1,171 @@
+package pkgthing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger receives log messages with structured fields. A nil Logger in
+// Options, Syncer or elsewhere logs info and above as text to stderr.
+type Logger interface {
+	Log(level LogLevel, message string, fields ...LogField)
+}
+
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+type LogLevel uint8
+
+const (
+	LOG_DEBUG = LogLevel(iota)
+	LOG_INFO
+	LOG_WARN
+	LOG_ERROR
+)
+
+func ParseLogLevel(text string) (LogLevel, error) {
+	for level := LOG_DEBUG; level <= LOG_ERROR; level++ {
+		if text == level.String() {
+			return level, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown log level: %s", text)
+}
+
+func (level LogLevel) String() string {
+	switch level {
+	case LOG_DEBUG:
+		return "debug"
+	case LOG_INFO:
+		return "info"
+	case LOG_WARN:
+		return "warn"
+	case LOG_ERROR:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// MakeTextLogger logs lines of key=value pairs.
+func MakeTextLogger(w io.Writer, level LogLevel) Logger {
+	return &writerLogger{
+		writer: w,
+		level:  level,
+		format: formatText,
+	}
+}
+
+// MakeJsonLogger logs one JSON object per line.
+func MakeJsonLogger(w io.Writer, level LogLevel) Logger {
+	return &writerLogger{
+		writer: w,
+		level:  level,
+		format: formatJson,
+	}
+}
+
+type writerLogger struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	level  LogLevel
+	format func(when time.Time, level LogLevel, message string, fields []LogField) []byte
+}
+
+func (logger *writerLogger) Log(level LogLevel, message string, fields ...LogField) {
+	if level < logger.level {
+		return
+	}
+
+	line := logger.format(time.Now().UTC(), level, message, fields)
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.writer.Write(line)
+}
+
+func formatText(when time.Time, level LogLevel, message string, fields []LogField) []byte {
+	parts := []string{
+		when.Format(time.RFC3339),
+		strings.ToUpper(level.String()),
+		message,
+	}
+
+	for _, field := range fields {
+		value := fmt.Sprint(field.Value)
+
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+
+		parts = append(parts, field.Key+"="+value)
+	}
+
+	return []byte(strings.Join(parts, " ") + "\n")
+}
+
+func formatJson(when time.Time, level LogLevel, message string, fields []LogField) []byte {
+	record := map[string]interface{}{}
+
+	for _, field := range fields {
+		record[field.Key] = field.Value
+	}
+
+	record["time"] = when.Format(time.RFC3339Nano)
+	record["level"] = level.String()
+	record["msg"] = message
+
+	text, err := json.Marshal(record)
+
+	if err != nil {
+		text, _ = json.Marshal(map[string]interface{}{
+			"time":  record["time"],
+			"level": record["level"],
+			"msg":   message,
+			"error": "Unencodable log fields: " + err.Error(),
+		})
+	}
+
+	return append(text, '\n')
+}
+
+var defaultLogger = MakeTextLogger(os.Stderr, LOG_INFO)
+
+func useLogger(logger Logger) Logger {
+	if logger == nil {
+		return defaultLogger
+	}
+
+	return logger
+}
+
+// packageFields identifies a package in log messages, without its data.
+func packageFields(info PackageInfo, extra ...LogField) []LogField {
+	fields := []LogField{
+		{Key: "package", Value: info.Name},
+		{Key: "system", Value: info.System},
+	}
+
+	if info.IpfsPath != "" {
+		fields = append(fields, LogField{Key: "ipfs_path", Value: info.IpfsPath})
+	}
+
+	return append(fields, extra...)
+}
+
+func errorField(err error) LogField {
+	return LogField{
+		Key:   "error",
+		Value: err.Error(),
+	}
+}
@@ -0,0 +1,255 @@
+package pkgthing
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// A Syncer runs each listed package through its stages in order: Filters,
+// then the Getter, then Transforms, then the Adder, then Hooks. Filters share
+// the getter concurrency limit and Hooks share the adder limit.
+//
+// The Adder signs each publication with its own key, since only it knows the
+// IpfsPath and storage metadata that are signed. A CoSigningHook adds the
+// signatures of further keys once a package is added.
+type SyncStage interface {
+	StageName() string
+}
+
+// SyncFilter decides whether a listed package is synced at all.
+type SyncFilter interface {
+	SyncStage
+	Keep(info PackageInfo) (bool, error)
+}
+
+// SyncTransform changes a package before it is added.
+type SyncTransform interface {
+	SyncStage
+	Transform(pack Package) (Package, error)
+}
+
+// SyncHook is called with each package once it is added.
+type SyncHook interface {
+	SyncStage
+	Synced(info PackageInfo) error
+}
+
+var ErrSyncSkipped = errors.New("Skipped by filter")
+
+// NameFilter keeps packages whose name matches any Include glob, or every
+// package when there are none, unless the name matches an Exclude glob.
+type NameFilter struct {
+	Include []string
+	Exclude []string
+}
+
+func (filter NameFilter) StageName() string {
+	return "name"
+}
+
+func (filter NameFilter) Keep(info PackageInfo) (bool, error) {
+	for _, pattern := range filter.Exclude {
+		if globMatch(pattern, info.Name) {
+			return false, nil
+		}
+	}
+
+	if len(filter.Include) == 0 {
+		return true, nil
+	}
+
+	for _, pattern := range filter.Include {
+		if globMatch(pattern, info.Name) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// MetaDataFilter keeps packages whose metadata value for Key matches the
+// Value glob, or drops them if Exclude is set.
+type MetaDataFilter struct {
+	Key     string
+	Value   string
+	Exclude bool
+}
+
+func ParseMetaDataFilter(text string, exclude bool) (MetaDataFilter, error) {
+	parts := strings.SplitN(text, "=", 2)
+
+	if len(parts) != 2 || parts[0] == "" {
+		return MetaDataFilter{}, fmt.Errorf("Expected key=glob: %s", text)
+	}
+
+	filter := MetaDataFilter{
+		Key:     parts[0],
+		Value:   parts[1],
+		Exclude: exclude,
+	}
+
+	return filter, nil
+}
+
+func (filter MetaDataFilter) StageName() string {
+	return "metadata:" + filter.Key
+}
+
+func (filter MetaDataFilter) Keep(info PackageInfo) (bool, error) {
+	matched := globMatch(filter.Value, info.GetMetaData(filter.Key))
+	return matched != filter.Exclude, nil
+}
+
+// Deduplicator drops packages already published with the same name, version
+// and architecture, and repeats within one sync.
+type Deduplicator struct {
+	Searcher PackageSearcher
+
+	mutex sync.Mutex
+	seen  map[string]bool
+}
+
+func (dedup *Deduplicator) StageName() string {
+	return "dedup"
+}
+
+func (dedup *Deduplicator) Keep(info PackageInfo) (bool, error) {
+	key := aptFileName(info)
+
+	dedup.mutex.Lock()
+	if dedup.seen == nil {
+		dedup.seen = map[string]bool{}
+	}
+
+	repeated := dedup.seen[key]
+	dedup.seen[key] = true
+	dedup.mutex.Unlock()
+
+	if repeated {
+		return false, nil
+	}
+
+	term := PackageSearchTerm{
+		SearchKey:  SEARCH_NAME,
+		SearchTerm: info.Name,
+		System:     info.System,
+	}
+
+	found, err := dedup.Searcher.Search(term)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, other := range found {
+		if other.Name == info.Name && aptFileName(other) == key {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// MetaDataEnricher sets fixed metadata on every package.
+type MetaDataEnricher struct {
+	MetaData []MetaDataEntry
+}
+
+func ParseMetaDataEntry(text string) (MetaDataEntry, error) {
+	parts := strings.SplitN(text, "=", 2)
+
+	if len(parts) != 2 || parts[0] == "" {
+		return MetaDataEntry{}, fmt.Errorf("Expected key=value: %s", text)
+	}
+
+	entry := MetaDataEntry{
+		MetaDataKey:   parts[0],
+		MetaDataValue: parts[1],
+	}
+
+	return entry, nil
+}
+
+func (enricher MetaDataEnricher) StageName() string {
+	return "enrich"
+}
+
+func (enricher MetaDataEnricher) Transform(pack Package) (Package, error) {
+	for _, entry := range enricher.MetaData {
+		pack.PackageInfo = pack.withMetaData(entry.MetaDataKey, entry.MetaDataValue)
+	}
+
+	return pack, nil
+}
+
+// AttestingHook attests Claim for every synced package.
+type AttestingHook struct {
+	Attester PackageAttester
+	Claim    string
+}
+
+func (hook AttestingHook) StageName() string {
+	return "attest:" + hook.Claim
+}
+
+func (hook AttestingHook) Synced(info PackageInfo) error {
+	return hook.Attester.Attest(info, hook.Claim)
+}
+
+// CoSigningHook signs each added package with another key as well.
+type CoSigningHook struct {
+	CoSigner PackageCoSigner
+	Key      KeyReference
+}
+
+func (hook CoSigningHook) StageName() string {
+	return "cosign:" + hook.Key.String()
+}
+
+func (hook CoSigningHook) Synced(info PackageInfo) error {
+	return hook.CoSigner.CoSign(info)
+}
+
+func (syncer Syncer) keep(info PackageInfo) error {
+	for _, filter := range syncer.Filters {
+		keep, err := filter.Keep(info)
+
+		if err != nil {
+			return errors.Wrapf(err, "Stage '%s' failed", filter.StageName())
+		}
+
+		if !keep {
+			return errors.Wrapf(ErrSyncSkipped, "Stage '%s'", filter.StageName())
+		}
+	}
+
+	return nil
+}
+
+func (syncer Syncer) transform(pack Package) (Package, error) {
+	for _, transform := range syncer.Transforms {
+		var err error
+		pack, err = transform.Transform(pack)
+
+		if err != nil {
+			return Package{}, errors.Wrapf(err, "Stage '%s' failed", transform.StageName())
+		}
+	}
+
+	return pack, nil
+}
+
+func (syncer Syncer) runHooks(info PackageInfo) error {
+	for _, hook := range syncer.Hooks {
+		err := hook.Synced(info)
+
+		if err != nil {
+			return errors.Wrapf(err, "Stage '%s' failed", hook.StageName())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package pkgthing
+
+import (
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestNameFilter(t *testing.T) {
+	filter := NameFilter{Include: []string{"lib*"}, Exclude: []string{"*-dbg"}}
+
+	for name, expected := range map[string]bool{
+		"libc6":     true,
+		"libc6-dbg": false,
+		"bash":      false,
+	} {
+		keep, err := filter.Keep(PackageInfo{Name: name})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if keep != expected {
+			t.Errorf("Expected Keep(%s) to be %v", name, expected)
+		}
+	}
+}
+
+func TestMetaDataFilter(t *testing.T) {
+	filter, err := ParseMetaDataFilter("architecture=amd*", true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keep, _ := filter.Keep(testPackageInfo("ubuntu", "bash", "4.4", "amd64"))
+	if keep {
+		t.Error("Expected excluded architecture to be dropped")
+	}
+
+	keep, _ = filter.Keep(testPackageInfo("ubuntu", "bash", "4.4", "i386"))
+	if !keep {
+		t.Error("Expected other architecture to be kept")
+	}
+
+	_, err = ParseMetaDataFilter("novalue", false)
+
+	if err == nil {
+		t.Error("Expected a filter without '=' to fail")
+	}
+}
+
+func TestDeduplicator(t *testing.T) {
+	published := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	dedup := &Deduplicator{Searcher: &fakeSearcher{found: []PackageInfo{published}}}
+
+	for _, test := range []struct {
+		info     PackageInfo
+		expected bool
+	}{
+		{testPackageInfo("ubuntu", "bash", "4.4", "amd64"), false},
+		{testPackageInfo("ubuntu", "bash", "5.0", "amd64"), true},
+		{testPackageInfo("ubuntu", "bash", "5.0", "amd64"), false},
+	} {
+		keep, err := dedup.Keep(test.info)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if keep != test.expected {
+			t.Errorf("Expected Keep(%s) to be %v", aptFileName(test.info), test.expected)
+		}
+	}
+}
+
+func TestSyncerRunsStages(t *testing.T) {
+	listed := []PackageInfo{
+		testPackageInfo("ubuntu", "libc6", "2.27", "amd64"),
+		testPackageInfo("ubuntu", "libc6-dbg", "2.27", "amd64"),
+		testPackageInfo("ubuntu", "bash", "4.4", "amd64"),
+	}
+
+	adder := &fakeManager{}
+	cosigner := &fakeCoSigner{}
+	status := &SyncStatus{}
+	syncer := Syncer{
+		Lister:  fakeLister(listed),
+		Getter:  &fakeGetter{},
+		Adder:   adder,
+		Status:  status,
+		Filters: []SyncFilter{NameFilter{Include: []string{"lib*"}, Exclude: []string{"*-dbg"}}},
+		Transforms: []SyncTransform{MetaDataEnricher{MetaData: []MetaDataEntry{
+			{MetaDataKey: CHANNEL_KEY, MetaDataValue: "stable"},
+		}}},
+		Hooks: []SyncHook{CoSigningHook{CoSigner: cosigner}},
+	}
+
+	err := syncer.AddAllPackages()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(adder.packages) != 1 || adder.packages[0].Name != "libc6" {
+		t.Fatalf("Expected only libc6 to be added but got %v", adder.packages)
+	}
+
+	if adder.packages[0].GetMetaData(CHANNEL_KEY) != "stable" {
+		t.Error("Expected the enricher to set the channel")
+	}
+
+	if names := cosigner.names(); len(names) != 1 || names[0] != "libc6" {
+		t.Errorf("Expected libc6 to be co-signed but got %v", names)
+	}
+
+	progress := status.Progress()
+	if progress.Running || progress.Synced != 1 || progress.Skipped != 2 {
+		t.Errorf("Unexpected progress %+v", progress)
+	}
+}
+
+func TestNilSyncStatus(t *testing.T) {
+	var status *SyncStatus
+
+	if !status.TryStart() {
+		t.Error("Expected a nil status to start")
+	}
+
+	status.succeeded()
+
+	if status.Progress() != (SyncProgress{}) {
+		t.Error("Expected a nil status to report no progress")
+	}
+}
+
+type fakeLister []PackageInfo
+
+func (lister fakeLister) GetInstalledPackages() ([]PackageInfo, error) {
+	return lister, nil
+}
+
+type fakeCoSigner struct {
+	sync.Mutex
+	signed []PackageInfo
+}
+
+func (cosigner *fakeCoSigner) CoSign(info PackageInfo) error {
+	cosigner.Lock()
+	defer cosigner.Unlock()
+
+	cosigner.signed = append(cosigner.signed, info)
+	return nil
+}
+
+func (cosigner *fakeCoSigner) names() []string {
+	cosigner.Lock()
+	defer cosigner.Unlock()
+
+	names := []string{}
+	for _, info := range cosigner.signed {
+		names = append(names, info.Name)
+	}
+
+	sort.Strings(names)
+	return names
+}
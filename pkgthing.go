@@ -3,8 +3,9 @@ package pkgthing
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -18,11 +19,15 @@ type Package struct {
 }
 
 type PackageInfo struct {
-	Name       string
-	System     string
-	IpfsPath   string
-	MetaData   []MetaDataEntry
-	Signatures []Signature
+	Name         string
+	System       string
+	IpfsPath     string
+	MetaData     []MetaDataEntry
+	Signatures   []Signature
+	Yanks        []Yank
+	Attestations []Attestation
+	Promotions   []Promotion
+	Published    time.Time
 }
 
 func (info PackageInfo) GetMetaData(key string) string {
@@ -35,6 +40,52 @@ func (info PackageInfo) GetMetaData(key string) string {
 	return ""
 }
 
+func (info PackageInfo) HasMetaData(key, value string) bool {
+	for _, entry := range info.MetaData {
+		if entry.MetaDataKey == key && entry.MetaDataValue == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (info PackageInfo) withMetaData(key, value string) PackageInfo {
+	metadata := make([]MetaDataEntry, 0, len(info.MetaData)+1)
+	for _, entry := range info.MetaData {
+		if entry.MetaDataKey != key {
+			metadata = append(metadata, entry)
+		}
+	}
+
+	entry := MetaDataEntry{
+		MetaDataKey:   key,
+		MetaDataValue: value,
+	}
+
+	info.MetaData = append(metadata, entry)
+	return info
+}
+
+func (info PackageInfo) withoutMetaData(key string) PackageInfo {
+	metadata := make([]MetaDataEntry, 0, len(info.MetaData))
+	for _, entry := range info.MetaData {
+		if entry.MetaDataKey != key {
+			metadata = append(metadata, entry)
+		}
+	}
+
+	info.MetaData = metadata
+	return info
+}
+
+// withDataSum records the hash and size of the package data before encoding,
+// so that readers can describe a package without downloading it.
+func (info PackageInfo) withDataSum(sum string, size int64) PackageInfo {
+	info = info.withMetaData(SHA256_KEY, sum)
+	return info.withMetaData(SIZE_KEY, fmt.Sprint(size))
+}
+
 type MetaDataEntry struct {
 	MetaDataKey   string
 	MetaDataValue string
@@ -65,11 +116,13 @@ func ParseSearchKey(key string) (SearchKey, error) {
 }
 
 type PackageSearchTerm struct {
-	SearchKey    SearchKey
-	SearchMethod SearchMethod
-	SearchTerm   string
-	System       string
-	Keys         []KeyReference
+	SearchKey     SearchKey
+	SearchMethod  SearchMethod
+	SearchTerm    string
+	System        string
+	Keys          []KeyReference
+	IncludeYanked bool
+	Channel       string
 }
 
 type PackageGetter interface {
@@ -84,34 +137,197 @@ type PackageSearcher interface {
 	Search(term PackageSearchTerm) ([]PackageInfo, error)
 }
 
+type PackageYanker interface {
+	Yank(info PackageInfo, reason string) error
+}
+
+type PackageAttester interface {
+	Attest(info PackageInfo, claim string) error
+}
+
+type PackagePromoter interface {
+	Promote(info PackageInfo, from, to, approver string) error
+}
+
+type PackageCoSigner interface {
+	CoSign(info PackageInfo) error
+}
+
+type PackageRepublisher interface {
+	Republish(info PackageInfo) (PackageInfo, error)
+}
+
 type PackageManager interface {
 	PackageAdder
 	PackageGetter
 	PackageSearcher
+	PackageYanker
+	PackageAttester
+	PackagePromoter
+}
+
+// PackageOpener streams package data rather than reading it into memory.
+// Find applies the same checks as Get and Open reads the package Find found.
+type PackageOpener interface {
+	Find(info PackageInfo) (PackageInfo, error)
+	Open(info PackageInfo) (io.ReadCloser, error)
 }
 
 type PackageLister interface {
 	GetInstalledPackages() ([]PackageInfo, error)
 }
 
+type SignatureChecker interface {
+	Check(info PackageInfo) error
+}
+
+type PackageInstaller interface {
+	InstallPackage(pack Package) error
+}
+
 type Options struct {
-	Store   ContentAddressableStorage
-	Godless api.Client
+	Store           ContentAddressableStorage
+	Godless         api.Client
+	SearchCacheTTL  time.Duration
+	Chunks          ChunkOptions
+	Deltas          bool
+	Compression     string
+	Signer          Signer
+	IncludeYanked   bool
+	ConflictPolicy  ConflictPolicy
+	Trust           SignatureChecker
+	LogPublications bool
+	// Yankers may yank any package. Publishers may always yank their own.
+	Yankers []KeyReference
+	// Channel limits Get to packages in the channel.
+	Channel string
+	// Promoters may move packages between channels.
+	Promoters []KeyReference
+	Observer  Observer
+	Logger    Logger
 }
 
 func New(options Options) PackageManager {
+	if options.ConflictPolicy == nil {
+		options.ConflictPolicy = NewestPolicy{}
+	}
+
 	return &pkgthing{
-		Options: options,
+		Options:  options,
+		searches: makeSearchCache(options.SearchCacheTTL),
+		chunks: chunkStore{
+			store:   options.Store,
+			options: options.Chunks,
+			logger:  options.Logger,
+		},
 	}
 }
 
 type pkgthing struct {
 	Options
+	searches *searchCache
+	chunks   chunkStore
 }
 
 func (thing *pkgthing) Get(info PackageInfo) (Package, error) {
+	event := Event{
+		Operation: GET_OPERATION,
+		Info:      info,
+	}
+
+	notify(thing.Observer, event)
+
+	pack, err := thing.get(info)
+
+	if err == nil {
+		event.Info = pack.PackageInfo
+		event.Bytes = int64(len(pack.Data))
+		event.Total = event.Bytes
+	}
+
+	notifyResult(thing.Observer, event, err)
+
+	return pack, err
+}
+
+func (thing *pkgthing) get(info PackageInfo) (Package, error) {
 	const failMsg = "Get failed"
 
+	if info.IpfsPath != "" {
+		return thing.getByPath(info)
+	}
+
+	pack, err := thing.findPackage(info)
+
+	if err != nil {
+		return Package{}, errors.Wrap(err, failMsg)
+	}
+
+	thing.logger().Log(LOG_DEBUG, "Found package", packageFields(pack.PackageInfo)...)
+
+	err = thing.loadPackageData(&pack)
+
+	if err != nil {
+		return Package{}, errors.Wrap(err, failMsg)
+	}
+
+	return pack, nil
+}
+
+func (thing *pkgthing) Find(info PackageInfo) (PackageInfo, error) {
+	const failMsg = "Find failed"
+
+	if info.IpfsPath != "" {
+		found, err := thing.findIndexed(info)
+
+		if err != nil {
+			return PackageInfo{}, errors.Wrap(err, failMsg)
+		}
+
+		return found, nil
+	}
+
+	pack, err := thing.findPackage(info)
+
+	if err != nil {
+		return PackageInfo{}, errors.Wrap(err, failMsg)
+	}
+
+	return pack.PackageInfo, nil
+}
+
+// Open streams the data of a package returned by Find. Packages rebuilt from
+// a delta are still read whole.
+func (thing *pkgthing) Open(info PackageInfo) (io.ReadCloser, error) {
+	const failMsg = "Open failed"
+
+	if data, ok := thing.loadFromDelta(info); ok {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	var stored io.ReadCloser
+	var err error
+
+	if isChunked(info) {
+		stored, err = thing.chunks.open(info.IpfsPath)
+	} else {
+		stored, err = thing.Store.Cat(info.IpfsPath)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, failMsg)
+	}
+
+	reader, err := decompressReader(info.GetMetaData(COMPRESSION_KEY), stored)
+
+	if err != nil {
+		return nil, errors.Wrap(err, failMsg)
+	}
+
+	return reader, nil
+}
+
+func (thing *pkgthing) findCandidates(info PackageInfo) ([]PackageInfo, error) {
 	builder := &getBuilder{}
 	builder.setPackageInfo(info)
 
@@ -120,16 +336,92 @@ func (thing *pkgthing) Get(info PackageInfo) (Package, error) {
 	thing.logResponse(resp)
 
 	if err != nil {
-		return Package{}, errors.Wrap(err, failMsg)
+		return nil, err
+	}
+
+	return readPackageInfo(resp, thing.Yankers, thing.logger())
+}
+
+func (thing *pkgthing) findPackage(info PackageInfo) (Package, error) {
+	candidates, err := thing.findCandidates(info)
+
+	if err != nil {
+		return Package{}, err
+	}
+
+	if len(candidates) == 0 {
+		return Package{}, fmt.Errorf("Package '%s' not found on '%s'", info.Name, info.System)
+	}
+
+	chosen, err := thing.chooseCandidate(info, candidates)
+
+	if err != nil {
+		return Package{}, err
+	}
+
+	pack := Package{
+		PackageInfo: chosen,
+	}
+
+	return pack, nil
+}
+
+// chooseCandidate applies the yank, channel and trust checks before the
+// conflict policy.
+func (thing *pkgthing) chooseCandidate(info PackageInfo, candidates []PackageInfo) (PackageInfo, error) {
+	var err error
+
+	if !thing.IncludeYanked {
+		visible := withoutYanked(candidates)
+
+		if len(visible) == 0 {
+			yanked := candidates[0]
+			return PackageInfo{}, yankedError(yanked, yanked.YankReason())
+		}
+
+		candidates = visible
 	}
 
-	pack, err := readPackage(resp)
+	if thing.Channel != "" {
+		candidates = inChannel(candidates, thing.Channel, thing.Promoters)
+
+		if len(candidates) == 0 {
+			return PackageInfo{}, fmt.Errorf("Package '%s' not found in channel '%s'", info.Name, thing.Channel)
+		}
+	}
+
+	if thing.Trust != nil {
+		trusted := []PackageInfo{}
+		for _, candidate := range candidates {
+			err = thing.Trust.Check(candidate)
+
+			if err == nil {
+				trusted = append(trusted, candidate)
+			}
+		}
+
+		if len(trusted) == 0 {
+			return PackageInfo{}, err
+		}
+
+		candidates = trusted
+	}
+
+	return thing.ConflictPolicy.Choose(candidates)
+}
+
+func (thing *pkgthing) getByPath(info PackageInfo) (Package, error) {
+	const failMsg = "Get failed"
+
+	indexed, err := thing.findIndexed(info)
 
 	if err != nil {
 		return Package{}, errors.Wrap(err, failMsg)
 	}
 
-	log.Printf("Found package: %v", pack)
+	pack := Package{
+		PackageInfo: indexed,
+	}
 
 	err = thing.loadPackageData(&pack)
 
@@ -140,36 +432,153 @@ func (thing *pkgthing) Get(info PackageInfo) (Package, error) {
 	return pack, nil
 }
 
+// findIndexed looks up a blob fetched directly by IpfsPath, which otherwise
+// bypasses the index, and applies the yank and trust checks. Several
+// publications may share the blob, so the one chosen supplies the metadata
+// needed to decode it. A blob that is not indexed is loaded as described by
+// info, unless trust or a channel is required.
+func (thing *pkgthing) findIndexed(info PackageInfo) (PackageInfo, error) {
+	candidates, err := thing.findCandidates(info)
+
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	matching := []PackageInfo{}
+	for _, candidate := range candidates {
+		if normalizeHash(candidate.IpfsPath) == normalizeHash(info.IpfsPath) {
+			matching = append(matching, candidate)
+		}
+	}
+
+	if len(matching) == 0 {
+		if thing.Trust != nil || thing.Channel != "" {
+			return PackageInfo{}, fmt.Errorf("Package '%s' at '%s' is not in the index", info.Name, info.IpfsPath)
+		}
+
+		return info, nil
+	}
+
+	return thing.chooseCandidate(info, matching)
+}
+
+// Add stores and publishes a package. A package with no Data but an IpfsPath
+// is published without uploading, for a blob already in the store.
 func (thing *pkgthing) Add(pack Package) (PackageInfo, error) {
+	event := Event{
+		Operation: ADD_OPERATION,
+		Info:      pack.PackageInfo,
+		Total:     int64(len(pack.Data)),
+	}
+
+	notify(thing.Observer, event)
+
+	info, err := thing.add(pack)
+
+	if err == nil {
+		event.Info = info
+		event.Bytes = event.Total
+	}
+
+	notifyResult(thing.Observer, event, err)
+
+	return info, err
+}
+
+func (thing *pkgthing) add(pack Package) (PackageInfo, error) {
 	const failMsg = "Add failed"
 
-	path, err := thing.addIpfsBlob(pack.Data)
+	if pack.Data != nil || pack.IpfsPath == "" {
+		err := thing.storePackage(&pack)
+
+		if err != nil {
+			return PackageInfo{}, errors.Wrap(err, failMsg)
+		}
+	}
+
+	var err error
+	pack.PackageInfo, err = thing.signPublication(pack.PackageInfo)
 
 	if err != nil {
 		return PackageInfo{}, errors.Wrap(err, failMsg)
 	}
 
-	pack.IpfsPath = path
+	err = thing.index(pack.PackageInfo)
+
+	if err != nil {
+		return PackageInfo{}, errors.Wrap(err, failMsg)
+	}
+
+	return pack.PackageInfo, nil
+}
+
+// index writes the signed publication to the index, logging it first.
+func (thing *pkgthing) index(info PackageInfo) error {
+	// Log before indexing, so that an index row never exists without its entry.
+	if thing.LogPublications {
+		tlog := TransparencyLog{
+			Store:   thing.Store,
+			Godless: thing.Godless,
+		}
+
+		_, err := tlog.Append(info, thing.Signer)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	builder := &addBuilder{}
-	builder.setPackage(pack)
+	builder.setPackage(Package{PackageInfo: info})
 
 	resp, err := thing.sendQueryWithBuilder(builder)
 
 	thing.logResponse(resp)
 
 	if err != nil {
-		return PackageInfo{}, errors.Wrap(err, failMsg)
+		return err
 	}
 
-	info := pack.PackageInfo
-	info.IpfsPath = path
+	thing.searches.invalidate()
 
-	return info, nil
+	return nil
+}
+
+func (thing *pkgthing) storePackage(pack *Package) error {
+	pack.PackageInfo = pack.withoutEncoding()
+	pack.PackageInfo = pack.withDataSum(hashData(pack.Data), int64(len(pack.Data)))
+	stored, err := thing.encodePackage(pack)
+
+	if err != nil {
+		return err
+	}
+
+	if thing.chunks.shouldChunk(stored) {
+		pack.PackageInfo = pack.withMetaData(STORAGE_KEY, CHUNKED_STORAGE)
+	}
+
+	path, err := thing.addPackageData(pack.PackageInfo, stored)
+
+	if err != nil {
+		return err
+	}
+
+	pack.IpfsPath = path
+
+	if thing.Deltas {
+		pack.PackageInfo = thing.addDelta(*pack)
+	}
+
+	return nil
 }
 
 func (thing *pkgthing) Search(term PackageSearchTerm) ([]PackageInfo, error) {
 	const failMsg = "Search failed"
 
+	if cached, ok := thing.searches.get(term); ok {
+		return cached, nil
+	}
+
 	builder := &searchBuilder{}
 	builder.setSearchTerm(term)
 
@@ -181,37 +590,89 @@ func (thing *pkgthing) Search(term PackageSearchTerm) ([]PackageInfo, error) {
 		return nil, errors.Wrap(err, failMsg)
 	}
 
-	info, err := readPackageInfo(resp)
+	info, err := readPackageInfo(resp, thing.Yankers, thing.logger())
 
 	if err != nil {
 		return nil, errors.Wrap(err, failMsg)
 	}
 
+	if !term.IncludeYanked {
+		info = withoutYanked(info)
+	}
+
+	if len(term.Keys) > 0 {
+		info = signedByAny(info, term.Keys)
+	}
+
+	if term.Channel != "" {
+		info = inChannel(info, term.Channel, thing.Promoters)
+	}
+
+	thing.searches.put(term, info)
+
 	return info, nil
 }
 
 func (thing *pkgthing) loadPackageData(pack *Package) error {
-	reader, err := thing.Store.Cat(pack.IpfsPath)
+	if data, ok := thing.loadFromDelta(pack.PackageInfo); ok {
+		pack.Data = data
+		return nil
+	}
+
+	stored, err := thing.loadStoredData(pack.PackageInfo)
 
 	if err != nil {
 		return err
 	}
 
-	data, err := ioutil.ReadAll(reader)
+	data, err := decodePackageData(pack.PackageInfo, stored)
 
 	if err != nil {
 		return err
 	}
 
+	pack.Data = data
+	return nil
+}
+
+func (thing *pkgthing) loadStoredData(info PackageInfo) ([]byte, error) {
+	if isChunked(info) {
+		return thing.chunks.cat(info.IpfsPath)
+	}
+
+	event := Event{
+		Operation: GET_OPERATION,
+		Info:      info,
+	}
+
+	return thing.readBlob(info.IpfsPath, thing.Observer, event)
+}
+
+func (thing *pkgthing) catBlob(path string) ([]byte, error) {
+	return thing.readBlob(path, nil, Event{})
+}
+
+func (thing *pkgthing) readBlob(path string, observer Observer, event Event) ([]byte, error) {
+	reader, err := thing.Store.Cat(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(observeReader(reader, observer, event))
+
+	if err != nil {
+		return nil, err
+	}
+
 	go func() {
 		err := reader.Close()
 		if err != nil {
-			log.Print(err)
+			thing.logger().Log(LOG_WARN, "Failed to close blob", LogField{Key: "ipfs_path", Value: path}, errorField(err))
 		}
 	}()
 
-	pack.Data = data
-	return nil
+	return data, nil
 }
 
 func (thing *pkgthing) sendQueryWithBuilder(builder queryBuilder) (api.Response, error) {
@@ -229,11 +690,32 @@ func (thing *pkgthing) sendQuery(query *query.Query) (api.Response, error) {
 	return thing.Godless.Send(request)
 }
 
+func (thing *pkgthing) addPackageData(info PackageInfo, stored []byte) (string, error) {
+	if isChunked(info) {
+		return thing.chunks.add(stored)
+	}
+
+	event := Event{
+		Operation: ADD_OPERATION,
+		Info:      info,
+		Total:     int64(len(stored)),
+	}
+
+	return thing.Store.Add(observeReader(bytes.NewReader(stored), thing.Observer, event))
+}
+
 func (thing *pkgthing) addIpfsBlob(blob []byte) (string, error) {
 	reader := bytes.NewReader(blob)
 	return thing.Store.Add(reader)
 }
 
+func (thing *pkgthing) logger() Logger {
+	return useLogger(thing.Logger)
+}
+
 func (thing *pkgthing) logResponse(resp api.Response) {
 	// log.Println(resp)
 }
+
+const SHA256_KEY = "sha256"
+const SIZE_KEY = "size"
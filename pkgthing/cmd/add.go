@@ -25,6 +25,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -36,15 +38,28 @@ import (
 var addCmd = &cobra.Command{
 	Use:   "add",
 	Short: "Add a package to pkgthing",
+	Long: `Add a package to pkgthing.
+
+The name, version, architecture and other control fields of .deb and .rpm
+files are read from the file. Any of --name, --version or --architecture
+that are given must agree with it.
+
+Use --dir or --glob instead of --file to add many files at once. The sync
+stage flags, such as --include and --exclude, apply only to these.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		validateAddArgs()
 
+		if packageFilePath == "" {
+			addPackageFiles()
+			return
+		}
+
 		file := openPackageFile()
 		defer file.Close()
 
 		pack := makeNewPackage(file)
 
-		pkgthing := makePkgthing()
+		pkgthing := makeSigningPkgthing()
 		info, err := pkgthing.Add(pack)
 
 		if err != nil {
@@ -56,17 +71,157 @@ var addCmd = &cobra.Command{
 }
 
 var packageFilePath string
+var addVersion string
+var addArchitecture string
+var addDir string
+var addGlobs []string
+var addConcurrency int
 
 func validateAddArgs() {
-	ok := name != ""
-	ok = ok && system != ""
-	ok = ok && packageFilePath != ""
+	sources := 0
+	for _, given := range []bool{packageFilePath != "", addDir != "", len(addGlobs) > 0} {
+		if given {
+			sources++
+		}
+	}
+
+	if system == "" || sources != 1 {
+		die(errors.New("Must supply system and one of file, dir or glob"))
+	}
+
+	if packageFilePath == "" && (name != "" || addVersion != "" || addArchitecture != "") {
+		die(errors.New("Cannot supply name, version or architecture with dir or glob"))
+	}
+}
+
+func addPackageFiles() {
+	paths := findPackageFiles()
+
+	if len(paths) == 0 {
+		die(errors.New("No package files found"))
+	}
+
+	files := &pkgthing.PackageFiles{
+		Paths:  paths,
+		System: system,
+	}
+
+	mutex := &sync.Mutex{}
+	done := 0
+	added := 0
+	skipped := 0
+	failures := []string{}
+
+	// Without a progress bar, print a line per file.
+	bar := makeObserver()
+	observer := func(event pkgthing.Event) {
+		if bar != nil {
+			bar.Observe(event)
+		}
+
+		if event.Operation != pkgthing.SYNC_PACKAGE_OPERATION || event.Kind == pkgthing.EVENT_STARTED {
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		done++
+		status := "added"
+		switch event.Kind {
+		case pkgthing.EVENT_DONE:
+			added++
+		case pkgthing.EVENT_SKIPPED:
+			skipped++
+			status = "skipped"
+		case pkgthing.EVENT_FAILED:
+			failures = append(failures, fmt.Sprintf("%s: %s", event.Info.Name, event.Err.Error()))
+			status = "failed"
+		}
+
+		if bar == nil {
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s %s %s\n", done, len(paths), status, event.Info.Name, event.Info.IpfsPath)
+		}
+	}
+
+	thing := makeSigningPkgthing()
+	syncer := pkgthing.Syncer{
+		Adder:             thing,
+		Getter:            files,
+		Lister:            files,
+		GetterConcurrency: addConcurrency,
+		AdderConcurrency:  addConcurrency,
+		Observer:          pkgthing.ObserverFunc(observer),
+		Logger:            makeLogger(),
+	}
+	addSyncStages(&syncer, thing)
+
+	if channel != "" {
+		syncer.Transforms = append(syncer.Transforms, pkgthing.MetaDataEnricher{
+			MetaData: []pkgthing.MetaDataEntry{
+				{MetaDataKey: pkgthing.CHANNEL_KEY, MetaDataValue: channel},
+			},
+		})
+	}
+
+	err := syncer.AddAllPackages()
+
+	if err != nil {
+		die(err)
+	}
+
+	duplicates := files.Duplicates()
+	fmt.Printf("Added %d of %d packages, skipped %d, %d duplicates\n", added, len(paths), skipped, len(duplicates))
 
-	if !ok {
-		die(errors.New("Must supply name, system, and file"))
+	if len(duplicates) > 0 {
+		fmt.Println("Duplicates:")
+		for _, path := range duplicates {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+
+	if len(failures) > 0 {
+		fmt.Println("Failed:")
+		for _, failure := range failures {
+			fmt.Printf("  %s\n", failure)
+		}
+
+		os.Exit(1)
 	}
 }
 
+func findPackageFiles() []string {
+	patterns := addGlobs
+	if addDir != "" {
+		patterns = []string{filepath.Join(addDir, "*")}
+	}
+
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+
+		if err != nil {
+			die(err)
+		}
+
+		for _, match := range matches {
+			stat, err := os.Stat(match)
+
+			if err != nil {
+				die(err)
+			}
+
+			if stat.Mode().IsRegular() && !seen[match] {
+				seen[match] = true
+				paths = append(paths, match)
+			}
+		}
+	}
+
+	return paths
+}
+
 func makeNewPackage(r io.Reader) pkgthing.Package {
 	data, err := ioutil.ReadAll(r)
 
@@ -78,6 +233,38 @@ func makeNewPackage(r io.Reader) pkgthing.Package {
 	pack.Name = name
 	pack.System = system
 	pack.Data = data
+
+	if addVersion != "" {
+		pack.MetaData = append(pack.MetaData, pkgthing.MetaDataEntry{
+			MetaDataKey:   pkgthing.VERSION_KEY,
+			MetaDataValue: addVersion,
+		})
+	}
+
+	if channel != "" {
+		pack.MetaData = append(pack.MetaData, pkgthing.MetaDataEntry{
+			MetaDataKey:   pkgthing.CHANNEL_KEY,
+			MetaDataValue: channel,
+		})
+	}
+
+	if addArchitecture != "" {
+		pack.MetaData = append(pack.MetaData, pkgthing.MetaDataEntry{
+			MetaDataKey:   pkgthing.ARCHITECTURE_KEY,
+			MetaDataValue: addArchitecture,
+		})
+	}
+
+	pack, err = pkgthing.InspectPackage(pack)
+
+	if err != nil {
+		die(err)
+	}
+
+	if pack.Name == "" {
+		die(errors.New("Must supply name when it cannot be read from the file"))
+	}
+
 	return pack
 }
 
@@ -96,4 +283,11 @@ func init() {
 
 	addCmd.PersistentFlags().StringVar(&name, "name", "", "Package name")
 	addCmd.PersistentFlags().StringVar(&packageFilePath, "file", "", "Package file")
+	addCmd.PersistentFlags().StringVar(&addVersion, "version", "", "Package version")
+	addCmd.PersistentFlags().StringVar(&addArchitecture, "architecture", "", "Package architecture")
+	addCmd.PersistentFlags().StringVar(&channel, "channel", "", "Channel the package starts in")
+	addCmd.PersistentFlags().StringVar(&addDir, "dir", "", "Directory of package files")
+	addCmd.PersistentFlags().StringSliceVar(&addGlobs, "glob", nil, "Glob matching package files")
+	addSyncStageFlags(addCmd)
+	addCmd.PersistentFlags().IntVar(&addConcurrency, "concurrency", 0, "Package files read and added at once")
 }
@@ -0,0 +1,147 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// advisoryCmd represents the advisory command
+var advisoryCmd = &cobra.Command{
+	Use:   "advisory",
+	Short: "Publish package vulnerability advisories",
+}
+
+// advisoryAddCmd represents the advisory add command
+var advisoryAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Publish an advisory",
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAdvisoryAddArgs()
+
+		advisory := pkgthing.Advisory{
+			ID:         advisoryId,
+			System:     system,
+			Name:       name,
+			Severity:   advisorySeverity,
+			Summary:    advisorySummary,
+			Introduced: advisoryIntroduced,
+			Fixed:      advisoryFixed,
+		}
+
+		err := makeAdvisoryDatabase().Add(advisory)
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+// advisoryImportCmd represents the advisory import command
+var advisoryImportCmd = &cobra.Command{
+	Use:   "import [OSV JSON files]",
+	Short: "Publish advisories from OSV-format JSON files",
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAdvisoryImportArgs(args)
+
+		db := makeAdvisoryDatabase()
+
+		for _, path := range args {
+			for _, advisory := range readOsvFile(path) {
+				err := db.Add(advisory)
+
+				if err != nil {
+					die(err)
+				}
+
+				fmt.Printf("%s %s\n", advisory.ID, advisory.Name)
+			}
+		}
+	},
+}
+
+var advisoryId string
+var advisorySeverity string
+var advisorySummary string
+var advisoryIntroduced string
+var advisoryFixed string
+var osvEcosystem string
+
+func validateAdvisoryAddArgs() {
+	ok := name != ""
+	ok = ok && system != ""
+	ok = ok && advisoryId != ""
+
+	if !ok {
+		die(errors.New("Must supply name, system, and id"))
+	}
+}
+
+func validateAdvisoryImportArgs(args []string) {
+	if system == "" || len(args) == 0 {
+		die(errors.New("Must supply system and files"))
+	}
+}
+
+func makeAdvisoryDatabase() pkgthing.AdvisoryDatabase {
+	return pkgthing.AdvisoryDatabase{
+		Godless: makeGodless(),
+	}
+}
+
+func readOsvFile(path string) []pkgthing.Advisory {
+	file, err := os.Open(path)
+
+	if err != nil {
+		die(err)
+	}
+
+	defer file.Close()
+
+	advisories, err := pkgthing.ReadOSV(file, system, osvEcosystem)
+
+	if err != nil {
+		die(errors.Wrap(err, path))
+	}
+
+	return advisories
+}
+
+func init() {
+	RootCmd.AddCommand(advisoryCmd)
+	advisoryCmd.AddCommand(advisoryAddCmd)
+	advisoryCmd.AddCommand(advisoryImportCmd)
+
+	advisoryAddCmd.PersistentFlags().StringVar(&name, "name", "", "Package name")
+	advisoryAddCmd.PersistentFlags().StringVar(&advisoryId, "id", "", "Advisory ID")
+	advisoryAddCmd.PersistentFlags().StringVar(&advisorySeverity, "severity", "", "Severity")
+	advisoryAddCmd.PersistentFlags().StringVar(&advisorySummary, "summary", "", "Summary")
+	advisoryAddCmd.PersistentFlags().StringVar(&advisoryIntroduced, "introduced", "", "First affected version (default all earlier versions)")
+	advisoryAddCmd.PersistentFlags().StringVar(&advisoryFixed, "fixed", "", "First fixed version (default unfixed)")
+
+	advisoryImportCmd.PersistentFlags().StringVar(&osvEcosystem, "ecosystem", "", "Only import packages from this OSV ecosystem")
+}
@@ -0,0 +1,82 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Install exactly the packages in a lockfile",
+	Run: func(cmd *cobra.Command, args []string) {
+		validateApplyArgs()
+
+		lock := readLockFile()
+
+		applier := pkgthing.Applier{
+			Getter:    makePkgthing(),
+			Installer: makeUbuntu(),
+		}
+
+		err := applier.Apply(lock)
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+func validateApplyArgs() {
+	if lockFilePath == "" {
+		die(errors.New("Must supply lockfile"))
+	}
+}
+
+func readLockFile() pkgthing.LockFile {
+	file, err := os.Open(lockFilePath)
+
+	if err != nil {
+		die(err)
+	}
+
+	defer file.Close()
+
+	lock, err := pkgthing.ReadLockFile(file)
+
+	if err != nil {
+		die(err)
+	}
+
+	return lock
+}
+
+func init() {
+	RootCmd.AddCommand(applyCmd)
+
+	applyCmd.PersistentFlags().StringVar(&lockFilePath, "lockfile", DEFAULT_LOCK_FILE, "Lock file")
+}
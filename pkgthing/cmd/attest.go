@@ -0,0 +1,68 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// attestCmd represents the attest command
+var attestCmd = &cobra.Command{
+	Use:   "attest",
+	Short: "Sign a claim about a published package",
+	Run: func(cmd *cobra.Command, args []string) {
+		validateAttestArgs()
+
+		info := makePackageInfo()
+		info.IpfsPath = attestPath
+
+		pkgthing := makeSigningPkgthing()
+		err := pkgthing.Attest(info, attestClaim)
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+var attestPath string
+var attestClaim string
+
+func validateAttestArgs() {
+	ok := name != ""
+	ok = ok && system != ""
+	ok = ok && attestClaim != ""
+
+	if !ok {
+		die(errors.New("Must supply name, system, and claim"))
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(attestCmd)
+
+	attestCmd.PersistentFlags().StringVar(&name, "name", "", "Package name")
+	attestCmd.PersistentFlags().StringVar(&attestPath, "path", "", "IPFS path of the version to attest (default current)")
+	attestCmd.PersistentFlags().StringVar(&attestClaim, "claim", pkgthing.REPRODUCIBLE_BUILD_CLAIM, "Claim to sign")
+}
@@ -0,0 +1,57 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// auditHostCmd represents the audit-host command
+var auditHostCmd = &cobra.Command{
+	Use:   "audit-host",
+	Short: "Report installed Ubuntu packages with known advisories",
+	Run: func(cmd *cobra.Command, args []string) {
+		findings, err := pkgthing.AuditHost(makeUbuntu(), makeAdvisoryDatabase())
+
+		if err != nil {
+			die(err)
+		}
+
+		for _, finding := range findings {
+			info := finding.Package
+			advisory := finding.Advisory
+			fmt.Printf("%s %s %s %s %s\n", info.Name, info.GetMetaData(pkgthing.VERSION_KEY), advisory.ID, advisory.Severity, advisory.Summary)
+		}
+
+		if len(findings) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(auditHostCmd)
+}
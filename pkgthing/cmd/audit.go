@@ -0,0 +1,89 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Verify the transparency log against the index",
+	Long: `Verify the transparency log against the index.
+
+Every log entry must be signed by a key the keyring trust policy accepts for
+its package, unless --ignore-trust is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		report, err := pkgthing.Audit(makeTransparencyLog(), makePkgthing(), auditSystems, makeAuditTrust())
+
+		if err != nil {
+			die(err)
+		}
+
+		fmt.Printf("%d log entries\n", len(report.Entries))
+
+		for _, hash := range report.BadEntries {
+			fmt.Printf("bad entry: %s\n", hash)
+		}
+
+		for _, untrusted := range report.Untrusted {
+			fmt.Printf("untrusted entry: %s %s %s: %s\n", untrusted.Hash, untrusted.System, untrusted.Name, untrusted.Err.Error())
+		}
+
+		for _, info := range report.Unlogged {
+			fmt.Printf("unlogged: %s %s %s\n", info.System, info.Name, info.IpfsPath)
+		}
+
+		if !report.IsClean() {
+			os.Exit(1)
+		}
+	},
+}
+
+var auditSystems []string
+
+// makeAuditTrust checks log entry signers against the keyring trust policy.
+func makeAuditTrust() pkgthing.SignatureChecker {
+	if ignoreTrust {
+		return nil
+	}
+
+	keyring := readKeyring()
+
+	if keyring.Policy.IsEmpty() {
+		die(errors.New("The keyring has no trust rules to audit the log against: add one with 'pkgthing key trust' or pass --ignore-trust"))
+	}
+
+	return keyring.Policy
+}
+
+func init() {
+	RootCmd.AddCommand(auditCmd)
+
+	auditCmd.PersistentFlags().StringSliceVar(&auditSystems, "systems", nil, "Systems whose packages must all be logged")
+}
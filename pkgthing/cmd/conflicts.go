@@ -0,0 +1,98 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// conflictsCmd represents the conflicts command
+var conflictsCmd = &cobra.Command{
+	Use:   "conflicts",
+	Short: "List package versions published as more than one blob",
+	Run: func(cmd *cobra.Command, args []string) {
+		validateConflictsArgs()
+
+		conflicts, err := pkgthing.FindConflicts(makePkgthing(), system)
+
+		if err != nil {
+			die(err)
+		}
+
+		policy := makeConflictPolicy()
+		for _, conflict := range conflicts {
+			printConflict(conflict, policy)
+		}
+	},
+}
+
+func validateConflictsArgs() {
+	if system == "" {
+		die(errors.New("Must supply system"))
+	}
+}
+
+func printConflict(conflict pkgthing.Conflict, policy pkgthing.ConflictPolicy) {
+	fmt.Printf("%s %s %s %s\n", conflict.System, conflict.Name, conflict.Version, conflict.Architecture)
+
+	chosen, err := policy.Choose(conflict.Candidates)
+
+	if err != nil {
+		fmt.Printf("  unresolved: %s\n", err.Error())
+	}
+
+	for _, info := range conflict.Candidates {
+		marker := " "
+		if err == nil && info.IpfsPath == chosen.IpfsPath {
+			marker = "*"
+		}
+
+		fmt.Printf("  %s %s %s %s\n", marker, info.IpfsPath, info.Published.Format(__TIME_FORMAT), publishers(info))
+	}
+}
+
+func publishers(info pkgthing.PackageInfo) string {
+	if len(info.Signatures) == 0 {
+		return "unsigned"
+	}
+
+	text := ""
+	for i, sig := range info.Signatures {
+		if i > 0 {
+			text += ","
+		}
+
+		text += sig.Fingerprint.String()
+	}
+
+	return text
+}
+
+func init() {
+	RootCmd.AddCommand(conflictsCmd)
+}
+
+const __TIME_FORMAT = "2006-01-02T15:04:05Z07:00"
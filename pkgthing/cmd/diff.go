@@ -0,0 +1,126 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the packages of two hosts, snapshots or systems",
+	Long: `Compare the packages of two hosts, snapshots or systems.
+
+The --from and --to flags each take one of:
+
+  host               the packages installed on this Ubuntu host
+  snapshot:<hash>    a snapshot taken with 'pkgthing snapshot'
+  system:<name>      the packages published to a pkgthing system`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateDiffArgs()
+
+		from := makeDiffLister(diffFrom)
+		to := makeDiffLister(diffTo)
+
+		diff, err := pkgthing.Diff(from, to)
+
+		if err != nil {
+			die(err)
+		}
+
+		printDiff(diff)
+
+		if diffExitCode && !diff.IsEmpty() {
+			os.Exit(1)
+		}
+	},
+}
+
+var diffFrom string
+var diffTo string
+var diffExitCode bool
+
+func validateDiffArgs() {
+	if diffFrom == "" || diffTo == "" {
+		die(errors.New("Must supply from and to"))
+	}
+}
+
+func makeDiffLister(spec string) pkgthing.PackageLister {
+	if spec == __DIFF_HOST {
+		return makeUbuntu()
+	}
+
+	parts := strings.SplitN(spec, ":", 2)
+
+	if len(parts) != 2 || parts[1] == "" {
+		die(fmt.Errorf("Invalid package source: %s", spec))
+	}
+
+	switch parts[0] {
+	case __DIFF_SNAPSHOT:
+		return loadSnapshot(parts[1])
+	case __DIFF_SYSTEM:
+		return pkgthing.SystemLister{
+			Searcher: makePkgthing(),
+			System:   parts[1],
+		}
+	default:
+		die(fmt.Errorf("Unknown package source: %s", parts[0]))
+		return nil
+	}
+}
+
+func printDiff(diff pkgthing.PackageDiff) {
+	for _, info := range diff.Added {
+		fmt.Printf("+ %s %s %s\n", info.System, info.Name, info.GetMetaData(pkgthing.VERSION_KEY))
+	}
+
+	for _, info := range diff.Removed {
+		fmt.Printf("- %s %s %s\n", info.System, info.Name, info.GetMetaData(pkgthing.VERSION_KEY))
+	}
+
+	for _, change := range diff.Changed {
+		before := change.Before.GetMetaData(pkgthing.VERSION_KEY)
+		after := change.After.GetMetaData(pkgthing.VERSION_KEY)
+		fmt.Printf("~ %s %s %s -> %s\n", change.After.System, change.After.Name, before, after)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(diffCmd)
+
+	diffCmd.PersistentFlags().StringVar(&diffFrom, "from", "", "Package source to compare from")
+	diffCmd.PersistentFlags().StringVar(&diffTo, "to", "", "Package source to compare to")
+	diffCmd.PersistentFlags().BoolVar(&diffExitCode, "exit-code", false, "Exit with status 1 when there are differences")
+}
+
+const __DIFF_HOST = "host"
+const __DIFF_SNAPSHOT = "snapshot"
+const __DIFF_SYSTEM = "system"
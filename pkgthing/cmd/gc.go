@@ -0,0 +1,83 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Unpin IPFS blobs that no package references",
+	Long: `Unpin IPFS blobs that no package references.
+
+Every recursive pin on the IPFS node that is not referenced by a package in
+one of the given systems is unpinned, so the node should be dedicated to
+pkgthing. Saved snapshots and transparency log entries are kept. Use --keep
+for other blobs you want to retain.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateGcArgs()
+
+		tlog := makeTransparencyLog()
+		collector := pkgthing.GarbageCollector{
+			Searcher:  makePkgthing(),
+			Store:     pkgthing.MakeLoggingIpfsStorage(ipfsUrl, makeLogger()),
+			Systems:   gcSystems,
+			Keep:      gcKeep,
+			Snapshots: makeSnapshotIndex(),
+			Log:       &tlog,
+		}
+
+		garbage, err := collector.Collect(gcDryRun)
+
+		if err != nil {
+			die(err)
+		}
+
+		for _, hash := range garbage {
+			fmt.Println(hash)
+		}
+	},
+}
+
+var gcSystems []string
+var gcKeep []string
+var gcDryRun bool
+
+func validateGcArgs() {
+	if len(gcSystems) == 0 {
+		die(errors.New("Must supply systems"))
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(gcCmd)
+
+	gcCmd.PersistentFlags().StringSliceVar(&gcSystems, "systems", nil, "Systems whose packages are kept")
+	gcCmd.PersistentFlags().StringSliceVar(&gcKeep, "keep", nil, "Extra hashes to keep pinned")
+	gcCmd.PersistentFlags().BoolVar(&gcDryRun, "dry-run", false, "List unreferenced blobs without unpinning")
+}
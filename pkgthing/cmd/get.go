@@ -90,4 +90,6 @@ func init() {
 
 	getCmd.PersistentFlags().StringVar(&name, "name", "", "Package name")
 	getCmd.PersistentFlags().StringVar(&packageFilePath, "file", "", "Package file")
+	getCmd.PersistentFlags().StringVar(&channel, "channel", "", "Only get a package in this channel")
+	getCmd.PersistentFlags().BoolVar(&includeYanked, "include-yanked", false, "Allow getting a yanked package")
 }
@@ -0,0 +1,101 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// importApt represents the apt command
+var importApt = &cobra.Command{
+	Use:   "apt",
+	Short: "Add all packages from a local APT mirror",
+	Long: `Add all packages from a local APT mirror.
+
+Every package listed in dists/<dist>/<component>/binary-<arch>/Packages is
+published with its control fields as metadata, after checking its size and
+SHA256 against the index.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateImportAptArgs()
+
+		if importAptSystem == "" {
+			importAptSystem = importAptDist
+		}
+
+		mirror := &pkgthing.AptMirror{
+			Dir:           importAptDir,
+			Dist:          importAptDist,
+			System:        importAptSystem,
+			Components:    importAptComponents,
+			Architectures: importAptArchitectures,
+		}
+
+		thing := makeSigningPkgthing()
+		syncer := pkgthing.Syncer{
+			Adder:             thing,
+			Getter:            mirror,
+			Lister:            mirror,
+			GetterConcurrency: importAptGetters,
+			AdderConcurrency:  importAptAdders,
+			Observer:          makeObserver(),
+			Logger:            makeLogger(),
+		}
+		addSyncStages(&syncer, thing)
+		err := syncer.AddAllPackages()
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+var importAptDir string
+var importAptDist string
+var importAptSystem string
+var importAptComponents []string
+var importAptArchitectures []string
+var importAptGetters int
+var importAptAdders int
+
+func validateImportAptArgs() {
+	if importAptDir == "" {
+		die(errors.New("Must supply dir"))
+	}
+
+	if importAptDist == "" {
+		die(errors.New("Must supply dist"))
+	}
+}
+
+func init() {
+	importCmd.AddCommand(importApt)
+
+	importApt.PersistentFlags().StringVar(&importAptDir, "dir", "", "Root directory of the mirror")
+	importApt.PersistentFlags().StringVar(&importAptDist, "dist", "", "Distribution to import")
+	importApt.PersistentFlags().StringVar(&importAptSystem, "system", "", "System to publish to (default is the dist)")
+	importApt.PersistentFlags().StringSliceVar(&importAptComponents, "components", nil, "Components to import (default all)")
+	importApt.PersistentFlags().StringSliceVar(&importAptArchitectures, "architectures", nil, "Architectures to import (default all)")
+	importApt.PersistentFlags().IntVar(&importAptGetters, "read-concurrency", 0, "Packages read from the mirror at once")
+	importApt.PersistentFlags().IntVar(&importAptAdders, "add-concurrency", 0, "Packages added to pkgthing at once")
+}
@@ -0,0 +1,290 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// keyCmd represents the key command
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage signing keys and the trust policy",
+	Long: `Manage signing keys and the trust policy.
+
+Once any key is trusted, 'get' only accepts packages that match a trust rule
+and carry enough signatures from that rule's keys. Add a rule with
+--system '*' --name '*' to cover everything else.`,
+}
+
+// keyGenerateCmd represents the key generate command
+var keyGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a new signing key",
+	Run: func(cmd *cobra.Command, args []string) {
+		keyring := readKeyring()
+
+		key, err := keyring.Generate(keyName)
+
+		if err != nil {
+			die(err)
+		}
+
+		if keyDefault {
+			keyring.Default = key.Reference().String()
+		}
+
+		writeKeyring(keyring)
+
+		fmt.Println(key.Reference())
+	},
+}
+
+// keyImportCmd represents the key import command
+var keyImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import a public key, or a private key file",
+	Run: func(cmd *cobra.Command, args []string) {
+		validateKeyImportArgs()
+
+		keyring := readKeyring()
+
+		var err error
+		if keyFilePath != "" {
+			err = importPrivateKey(&keyring)
+		} else {
+			err = importPublicKey(&keyring)
+		}
+
+		if err != nil {
+			die(err)
+		}
+
+		writeKeyring(keyring)
+	},
+}
+
+// keyExportCmd represents the key export command
+var keyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print a public key, or write a private key file",
+	Run: func(cmd *cobra.Command, args []string) {
+		keyring := readKeyring()
+
+		entry := lookupKey(keyring, keyFingerprint)
+
+		if keyFilePath == "" {
+			fmt.Println(entry.Public)
+			return
+		}
+
+		key, err := entry.PrivateKey()
+
+		if err != nil {
+			die(err)
+		}
+
+		err = pkgthing.WriteEd25519Key(keyFilePath, key)
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+// keyListCmd represents the key list command
+var keyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List keys and trust rules",
+	Run: func(cmd *cobra.Command, args []string) {
+		keyring := readKeyring()
+
+		for _, entry := range keyring.Keys {
+			printKey(keyring, entry)
+		}
+
+		for _, rule := range keyring.Policy.Rules {
+			fmt.Printf("rule system=%s name=%s required=%d keys=%v\n", globText(rule.System), globText(rule.Name), rule.Required, rule.Keys)
+		}
+	},
+}
+
+// keyTrustCmd represents the key trust command
+var keyTrustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Trust a key to sign packages",
+	Run: func(cmd *cobra.Command, args []string) {
+		validateKeyFingerprint()
+
+		keyring := readKeyring()
+		entry := lookupKey(keyring, keyFingerprint)
+
+		err := keyring.Trust(entry.Public, trustSystem, trustName, trustRequired)
+
+		if err != nil {
+			die(err)
+		}
+
+		writeKeyring(keyring)
+	},
+}
+
+// keyRevokeCmd represents the key revoke command
+var keyRevokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Stop trusting a key anywhere",
+	Run: func(cmd *cobra.Command, args []string) {
+		validateKeyFingerprint()
+
+		keyring := readKeyring()
+		entry := lookupKey(keyring, keyFingerprint)
+
+		err := keyring.Revoke(entry.Public)
+
+		if err != nil {
+			die(err)
+		}
+
+		writeKeyring(keyring)
+	},
+}
+
+var keyName string
+var keyFingerprint string
+var keyFilePath string
+var keyDefault bool
+var trustSystem string
+var trustName string
+var trustRequired int
+
+func validateKeyImportArgs() {
+	if keyFingerprint == "" && keyFilePath == "" {
+		die(errors.New("Must supply fingerprint or file"))
+	}
+}
+
+func validateKeyFingerprint() {
+	if keyFingerprint == "" {
+		die(errors.New("Must supply fingerprint"))
+	}
+}
+
+func importPublicKey(keyring *pkgthing.Keyring) error {
+	ref, err := pkgthing.ParseKeyReference(keyFingerprint)
+
+	if err != nil {
+		return err
+	}
+
+	return keyring.Import(keyName, ref)
+}
+
+func importPrivateKey(keyring *pkgthing.Keyring) error {
+	key, err := pkgthing.ReadEd25519Key(keyFilePath)
+
+	if err != nil {
+		return err
+	}
+
+	return keyring.ImportPrivate(keyName, key)
+}
+
+// lookupKey finds a key by fingerprint or name, defaulting to the default key.
+func lookupKey(keyring pkgthing.Keyring, fingerprint string) pkgthing.KeyringEntry {
+	if fingerprint == "" {
+		fingerprint = keyring.Default
+	}
+
+	entry, err := keyring.Lookup(fingerprint)
+
+	if err != nil {
+		die(err)
+	}
+
+	return entry
+}
+
+func printKey(keyring pkgthing.Keyring, entry pkgthing.KeyringEntry) {
+	kind := "public"
+	if entry.Private != "" {
+		kind = "private"
+	}
+
+	if entry.Public == keyring.Default {
+		kind += ",default"
+	}
+
+	if isRevoked(keyring, entry.Public) {
+		kind += ",revoked"
+	}
+
+	fmt.Printf("%s %s %s\n", entry.Public, kind, entry.Name)
+}
+
+func isRevoked(keyring pkgthing.Keyring, fingerprint string) bool {
+	for _, revoked := range keyring.Policy.Revoked {
+		if revoked == fingerprint {
+			return true
+		}
+	}
+
+	return false
+}
+
+func globText(glob string) string {
+	if glob == "" {
+		return "*"
+	}
+
+	return glob
+}
+
+func init() {
+	RootCmd.AddCommand(keyCmd)
+	keyCmd.AddCommand(keyGenerateCmd)
+	keyCmd.AddCommand(keyImportCmd)
+	keyCmd.AddCommand(keyExportCmd)
+	keyCmd.AddCommand(keyListCmd)
+	keyCmd.AddCommand(keyTrustCmd)
+	keyCmd.AddCommand(keyRevokeCmd)
+
+	keyGenerateCmd.PersistentFlags().StringVar(&keyName, "name", "", "Key name")
+	keyGenerateCmd.PersistentFlags().BoolVar(&keyDefault, "default", false, "Make this the default signing key")
+
+	keyImportCmd.PersistentFlags().StringVar(&keyName, "name", "", "Key name")
+	keyImportCmd.PersistentFlags().StringVar(&keyFingerprint, "fingerprint", "", "Public key fingerprint")
+	keyImportCmd.PersistentFlags().StringVar(&keyFilePath, "file", "", "Private key file")
+
+	keyExportCmd.PersistentFlags().StringVar(&keyFingerprint, "fingerprint", "", "Key fingerprint or name (default key if empty)")
+	keyExportCmd.PersistentFlags().StringVar(&keyFilePath, "file", "", "Write the private key to this file")
+
+	keyTrustCmd.PersistentFlags().StringVar(&keyFingerprint, "fingerprint", "", "Key fingerprint or name")
+	keyTrustCmd.PersistentFlags().StringVar(&trustSystem, "system", "*", "System glob the key is trusted for")
+	keyTrustCmd.PersistentFlags().StringVar(&trustName, "name", "*", "Package name glob the key is trusted for")
+	keyTrustCmd.PersistentFlags().IntVar(&trustRequired, "required", 0, "Signatures required by this rule (default 1)")
+
+	keyRevokeCmd.PersistentFlags().StringVar(&keyFingerprint, "fingerprint", "", "Key fingerprint or name")
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// lockCmd represents the lock command
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Resolve a manifest into a lockfile",
+	Run: func(cmd *cobra.Command, args []string) {
+		validateLockArgs()
+
+		manifest := readManifestFile()
+
+		thing := makePkgthing()
+		locker := pkgthing.Locker{
+			Searcher: thing,
+			Getter:   thing,
+		}
+
+		lock, err := locker.Lock(manifest)
+
+		if err != nil {
+			die(err)
+		}
+
+		writeLockFile(lock)
+	},
+}
+
+var manifestFilePath string
+var lockFilePath string
+
+func validateLockArgs() {
+	if manifestFilePath == "" || lockFilePath == "" {
+		die(errors.New("Must supply manifest and lockfile"))
+	}
+}
+
+func readManifestFile() pkgthing.Manifest {
+	file, err := os.Open(manifestFilePath)
+
+	if err != nil {
+		die(err)
+	}
+
+	defer file.Close()
+
+	manifest, err := pkgthing.ReadManifest(file)
+
+	if err != nil {
+		die(err)
+	}
+
+	return manifest
+}
+
+func writeLockFile(lock pkgthing.LockFile) {
+	file, err := os.Create(lockFilePath)
+
+	if err != nil {
+		die(err)
+	}
+
+	defer file.Close()
+
+	err = pkgthing.WriteLockFile(file, lock)
+
+	if err != nil {
+		die(err)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(lockCmd)
+
+	lockCmd.PersistentFlags().StringVar(&manifestFilePath, "manifest", "", "Manifest file")
+	lockCmd.PersistentFlags().StringVar(&lockFilePath, "lockfile", DEFAULT_LOCK_FILE, "Lock file")
+}
+
+const DEFAULT_LOCK_FILE = "pkgthing.lock"
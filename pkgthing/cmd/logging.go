@@ -0,0 +1,64 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+var logLevel string
+var logFormat string
+var logger pkgthing.Logger
+
+func makeLogger() pkgthing.Logger {
+	if logger != nil {
+		return logger
+	}
+
+	level, err := pkgthing.ParseLogLevel(logLevel)
+
+	if err != nil {
+		die(err)
+	}
+
+	switch logFormat {
+	case __TEXT_LOG_FORMAT:
+		logger = pkgthing.MakeTextLogger(os.Stderr, level)
+	case __JSON_LOG_FORMAT:
+		logger = pkgthing.MakeJsonLogger(os.Stderr, level)
+	default:
+		die(fmt.Errorf("Unknown log format: %s", logFormat))
+	}
+
+	return logger
+}
+
+func makeUbuntu() *pkgthing.Ubuntu {
+	return &pkgthing.Ubuntu{
+		Logger: makeLogger(),
+	}
+}
+
+const __TEXT_LOG_FORMAT = "text"
+const __JSON_LOG_FORMAT = "json"
@@ -0,0 +1,130 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// mirrorCmd represents the mirror command
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Copy the packages of a system from one index to another",
+	Long: `Copy the packages of a system from one index to another.
+
+Packages already in the destination index are skipped, so repeated runs only
+copy what is new. Without --copy-blobs both indexes must use the same IPFS
+node, and only the index entries are copied. With it the stored blobs are
+copied unchanged, so each package keeps its IPFS path. Each entry keeps the
+signatures of its original publishers, and your default key signs it
+alongside them. Yanked packages are yanked again with your key.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateMirrorArgs()
+
+		source := makeMirrorOptions(mirrorFrom, mirrorFromIpfs)
+		source.IncludeYanked = true
+
+		dest := makeMirrorOptions(mirrorTo, mirrorToIpfs)
+		dest.Signer = loadSigningKey()
+
+		mirror := pkgthing.IndexMirror{
+			Source:      pkgthing.New(source),
+			Dest:        pkgthing.New(dest),
+			System:      system,
+			CopyBlobs:   mirrorCopyBlobs,
+			SourceStore: source.Store,
+			DestStore:   dest.Store,
+		}
+
+		syncer := mirror.MakeSyncer()
+		syncer.GetterConcurrency = mirrorConcurrency
+		syncer.AdderConcurrency = mirrorConcurrency
+		syncer.Observer = makeObserver()
+		syncer.Logger = makeLogger()
+		addSyncStages(&syncer, mirror.Dest)
+
+		err := syncer.AddAllPackages()
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+var mirrorFrom string
+var mirrorTo string
+var mirrorFromIpfs string
+var mirrorToIpfs string
+var mirrorCopyBlobs bool
+var mirrorConcurrency int
+
+func validateMirrorArgs() {
+	if mirrorFrom == "" || mirrorTo == "" || system == "" {
+		die(errors.New("Must supply from, to and system"))
+	}
+
+	if !mirrorCopyBlobs && mirrorIpfsUrl(mirrorFromIpfs) != mirrorIpfsUrl(mirrorToIpfs) {
+		die(errors.New("Must copy blobs between different IPFS nodes"))
+	}
+}
+
+func mirrorIpfsUrl(addr string) string {
+	if addr == "" {
+		return ipfsUrl
+	}
+
+	return addr
+}
+
+// makeMirrorOptions returns the usual options for another index, using the
+// --ipfs node unless ipfsAddr is given.
+func makeMirrorOptions(godlessAddr, ipfsAddr string) pkgthing.Options {
+	options := makeOptions()
+
+	client, err := pkgthing.MakeRemoteGodlessClient(godlessAddr)
+
+	if err != nil {
+		die(err)
+	}
+
+	options.Godless = client
+
+	if ipfsAddr != "" {
+		options.Store = pkgthing.MakeLoggingIpfsStorage(ipfsAddr, makeLogger())
+	}
+
+	return options
+}
+
+func init() {
+	RootCmd.AddCommand(mirrorCmd)
+
+	addSyncStageFlags(mirrorCmd)
+	mirrorCmd.PersistentFlags().StringVar(&mirrorFrom, "from", "", "Godless address of the source index")
+	mirrorCmd.PersistentFlags().StringVar(&mirrorTo, "to", "", "Godless address of the destination index")
+	mirrorCmd.PersistentFlags().StringVar(&mirrorFromIpfs, "from-ipfs", "", "IPFS API URL of the source index (default --ipfs)")
+	mirrorCmd.PersistentFlags().StringVar(&mirrorToIpfs, "to-ipfs", "", "IPFS API URL of the destination index (default --ipfs)")
+	mirrorCmd.PersistentFlags().BoolVar(&mirrorCopyBlobs, "copy-blobs", false, "Copy package data between IPFS nodes")
+	mirrorCmd.PersistentFlags().IntVar(&mirrorConcurrency, "concurrency", 0, "Packages copied at once")
+}
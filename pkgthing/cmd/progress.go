@@ -0,0 +1,164 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+var showProgress bool
+var progress *progressBar
+
+// makeObserver returns the progress bar, or nil when progress is disabled or
+// stderr is not a terminal.
+func makeObserver() pkgthing.Observer {
+	if !showProgress || !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	if progress == nil {
+		progress = &progressBar{out: os.Stderr}
+	}
+
+	return progress
+}
+
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar renders sync progress as a bar, or the bytes transferred by a
+// single get or add.
+type progressBar struct {
+	mutex   sync.Mutex
+	out     io.Writer
+	syncing bool
+	total   int64
+	done    int64
+	failed  int64
+	skipped int64
+}
+
+func (bar *progressBar) Observe(event pkgthing.Event) {
+	bar.mutex.Lock()
+	defer bar.mutex.Unlock()
+
+	switch event.Operation {
+	case pkgthing.SYNC_OPERATION:
+		if event.Kind == pkgthing.EVENT_STARTED {
+			// A watching sync starts again after each pass.
+			bar.syncing = true
+			bar.total = event.Total
+			bar.done = 0
+			bar.failed = 0
+			bar.skipped = 0
+			return
+		}
+
+		bar.syncing = false
+		fmt.Fprintln(bar.out)
+	case pkgthing.SYNC_PACKAGE_OPERATION:
+		switch event.Kind {
+		case pkgthing.EVENT_DONE:
+			bar.done++
+		case pkgthing.EVENT_FAILED:
+			bar.failed++
+		case pkgthing.EVENT_SKIPPED:
+			bar.skipped++
+		default:
+			return
+		}
+
+		bar.renderSync(event.Info.Name)
+	default:
+		if bar.syncing {
+			return
+		}
+
+		switch event.Kind {
+		case pkgthing.EVENT_TRANSFERRED:
+			bar.renderTransfer(event)
+		case pkgthing.EVENT_DONE, pkgthing.EVENT_FAILED:
+			fmt.Fprintln(bar.out)
+		}
+	}
+}
+
+func (bar *progressBar) renderSync(name string) {
+	finished := bar.done + bar.failed + bar.skipped
+
+	filled := __PROGRESS_WIDTH
+	if bar.total > 0 {
+		filled = int(finished * __PROGRESS_WIDTH / bar.total)
+	}
+
+	// More packages may finish than were listed, if the lister was wrong.
+	if filled > __PROGRESS_WIDTH {
+		filled = __PROGRESS_WIDTH
+	} else if filled < 0 {
+		filled = 0
+	}
+
+	line := fmt.Sprintf("[%s%s] %d/%d", strings.Repeat("=", filled), strings.Repeat(" ", __PROGRESS_WIDTH-filled), finished, bar.total)
+
+	if bar.failed > 0 {
+		line += fmt.Sprintf(" %d failed", bar.failed)
+	}
+
+	if bar.skipped > 0 {
+		line += fmt.Sprintf(" %d skipped", bar.skipped)
+	}
+
+	fmt.Fprintf(bar.out, "\r%s %s%s", line, name, __CLEAR_LINE)
+}
+
+func (bar *progressBar) renderTransfer(event pkgthing.Event) {
+	line := fmt.Sprintf("%s %s %s", event.Operation, event.Info.Name, formatBytes(event.Bytes))
+
+	if event.Total > 0 {
+		line += " / " + formatBytes(event.Total)
+	}
+
+	fmt.Fprintf(bar.out, "\r%s%s", line, __CLEAR_LINE)
+}
+
+func formatBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+
+	size := float64(n)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+const __PROGRESS_WIDTH = 30
+const __CLEAR_LINE = "\x1b[K"
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+func TestProgressBarResetsBetweenSyncs(t *testing.T) {
+	buff := &bytes.Buffer{}
+	bar := &progressBar{out: buff}
+
+	for pass := 0; pass < 2; pass++ {
+		buff.Reset()
+		bar.Observe(pkgthing.Event{Kind: pkgthing.EVENT_STARTED, Operation: pkgthing.SYNC_OPERATION, Total: 3})
+
+		for _, kind := range []pkgthing.EventKind{pkgthing.EVENT_DONE, pkgthing.EVENT_SKIPPED, pkgthing.EVENT_FAILED} {
+			bar.Observe(pkgthing.Event{Kind: kind, Operation: pkgthing.SYNC_PACKAGE_OPERATION})
+		}
+
+		bar.Observe(pkgthing.Event{Kind: pkgthing.EVENT_DONE, Operation: pkgthing.SYNC_OPERATION})
+
+		if !strings.Contains(buff.String(), "] 3/3 1 failed 1 skipped") {
+			t.Errorf("Expected pass %d to count 3 packages but got %q", pass, buff.String())
+		}
+	}
+}
+
+func TestProgressBarClampsOverflow(t *testing.T) {
+	bar := &progressBar{out: &bytes.Buffer{}, total: 1, done: 5}
+
+	bar.renderSync("bash")
+}
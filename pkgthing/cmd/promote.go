@@ -0,0 +1,93 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// promoteCmd represents the promote command
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Move a published package into another channel",
+	Long: `Move a published package into another channel.
+
+The version is chosen by --path or --version, or else is the one get would
+choose. The promotion is signed with your default key and records the
+approver, which defaults to the name of that key. Only promotions signed by
+--promoters, or by keys the keyring trusts, count, and promoting with any
+other key fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validatePromoteArgs()
+
+		info := makePackageInfo()
+		info.IpfsPath = promotePath
+
+		if promoteVersion != "" {
+			info.MetaData = append(info.MetaData, pkgthing.MetaDataEntry{
+				MetaDataKey:   pkgthing.VERSION_KEY,
+				MetaDataValue: promoteVersion,
+			})
+		}
+
+		thing := makeSigningPkgthing()
+
+		if promoteApprover == "" {
+			promoteApprover = readKeyring().Default
+		}
+
+		err := thing.Promote(info, promoteFrom, promoteTo, promoteApprover)
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+var promotePath string
+var promoteVersion string
+var promoteFrom string
+var promoteTo string
+var promoteApprover string
+
+func validatePromoteArgs() {
+	ok := name != ""
+	ok = ok && system != ""
+	ok = ok && promoteTo != ""
+
+	if !ok {
+		die(errors.New("Must supply name, system, and to"))
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(promoteCmd)
+
+	promoteCmd.PersistentFlags().StringVar(&name, "name", "", "Package name")
+	promoteCmd.PersistentFlags().StringVar(&promotePath, "path", "", "IPFS path of the version to promote")
+	promoteCmd.PersistentFlags().StringVar(&promoteVersion, "version", "", "Version to promote")
+	promoteCmd.PersistentFlags().StringVar(&promoteFrom, "from", "", "Channel the package must currently be in")
+	promoteCmd.PersistentFlags().StringVar(&promoteTo, "to", "", "Channel to promote the package to")
+	promoteCmd.PersistentFlags().StringVar(&promoteApprover, "approver", "", "Who approved the promotion (default signing key name)")
+}
@@ -24,10 +24,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	godless "github.com/johnny-morrice/godless/api"
 	"github.com/johnny-morrice/pkgthing"
 )
 
@@ -53,19 +56,260 @@ var godlessUrl string
 var system string
 var name string
 
+var cacheDir string
+var cacheSize int64
+var searchCacheTTL time.Duration
+var chunkThreshold int
+var chunkDir string
+var useDeltas bool
+var compression string
+var keyringFile string
+var includeYanked bool
+var conflictPolicy string
+var trustedKeys []string
+var ignoreTrust bool
+var logPublications bool
+var requiredAttestations int
+var attestationClaim string
+var attesterKeys []string
+var channel string
+var promoterKeys []string
+
+var storage pkgthing.ContentAddressableStorage
+
+// makeStorage returns the one storage for the process, so that every user of
+// the cache shares its size accounting.
+func makeStorage() pkgthing.ContentAddressableStorage {
+	if storage == nil {
+		storage = buildStorage()
+	}
+
+	return storage
+}
+
+func buildStorage() pkgthing.ContentAddressableStorage {
+	ipfs := pkgthing.MakeLoggingIpfsStorage(ipfsUrl, makeLogger())
+
+	if cacheDir == "" {
+		return ipfs
+	}
+
+	cacheOptions := pkgthing.CacheOptions{
+		Dir:     cacheDir,
+		MaxSize: cacheSize * __MEGABYTE,
+		Logger:  makeLogger(),
+	}
+	cache, err := pkgthing.MakeCachingStorage(ipfs, cacheOptions)
+
+	if err != nil {
+		die(err)
+	}
+
+	return cache
+}
+
 func makePkgthing() pkgthing.PackageManager {
-	ipfs := pkgthing.MakeIpfsStorage(ipfsUrl)
-	godless, err := pkgthing.MakeRemoteGodlessClient(godlessUrl)
+	return pkgthing.New(makeOptions())
+}
+
+func makeSigningPkgthing() pkgthing.PackageManager {
+	options := makeOptions()
+	options.Signer = loadSigningKey()
+	return pkgthing.New(options)
+}
+
+// loadSigningKey reads the default key from the keyring, generating one on
+// first use.
+func loadSigningKey() pkgthing.Ed25519Key {
+	keyring := readKeyring()
+
+	if keyring.Default != "" {
+		key, err := keyring.DefaultKey()
+
+		if err != nil {
+			die(err)
+		}
+
+		return key
+	}
+
+	key, err := keyring.Generate(__DEFAULT_KEY_NAME)
+
+	if err != nil {
+		die(err)
+	}
+
+	writeKeyring(keyring)
+
+	makeLogger().Log(pkgthing.LOG_INFO, "Generated new signing key", pkgthing.LogField{Key: "key", Value: key.Reference()})
+
+	return key
+}
+
+func readKeyring() pkgthing.Keyring {
+	keyring, err := pkgthing.ReadKeyring(keyringFile)
+
+	if err != nil {
+		die(err)
+	}
+
+	return keyring
+}
+
+func writeKeyring(keyring pkgthing.Keyring) {
+	err := pkgthing.WriteKeyring(keyringFile, keyring)
+
+	if err != nil {
+		die(err)
+	}
+}
+
+func makeGodless() godless.Client {
+	client, err := pkgthing.MakeRemoteGodlessClient(godlessUrl)
+
+	if err != nil {
+		die(err)
+	}
+
+	return client
+}
+
+func makeTransparencyLog() pkgthing.TransparencyLog {
+	return pkgthing.TransparencyLog{
+		Store:   makeStorage(),
+		Godless: makeGodless(),
+	}
+}
+
+func makeSnapshotIndex() pkgthing.SnapshotIndex {
+	return pkgthing.GodlessSnapshotIndex{
+		Godless: makeGodless(),
+	}
+}
+
+func makeOptions() pkgthing.Options {
+	ipfs := makeStorage()
+	client := makeGodless()
+
+	method, err := pkgthing.ParseCompression(compression)
 
 	if err != nil {
 		die(err)
 	}
 
 	options := pkgthing.Options{
-		Store:   ipfs,
-		Godless: godless,
+		Store:          ipfs,
+		Godless:        client,
+		SearchCacheTTL: searchCacheTTL,
+		Chunks: pkgthing.ChunkOptions{
+			Threshold: chunkThreshold * __MEGABYTE,
+			Dir:       chunkDir,
+		},
+		Deltas:          useDeltas,
+		Compression:     method,
+		IncludeYanked:   includeYanked,
+		ConflictPolicy:  makeConflictPolicy(),
+		LogPublications: logPublications,
+		Yankers:         trustedKeyringKeys(),
+		Channel:         channel,
+		Promoters:       makePromoters(),
+		Observer:        makeObserver(),
+		Logger:          makeLogger(),
 	}
-	return pkgthing.New(options)
+
+	checks := pkgthing.CheckAll{}
+
+	if !ignoreTrust {
+		keyring := readKeyring()
+
+		if !keyring.Policy.IsEmpty() {
+			checks = append(checks, keyring.Policy)
+		}
+	}
+
+	if requiredAttestations > 0 {
+		policy := pkgthing.AttestationPolicy{
+			Required: requiredAttestations,
+			Claim:    attestationClaim,
+			Keys:     makeAttesters(),
+		}
+		checks = append(checks, policy)
+	}
+
+	if len(checks) > 0 {
+		options.Trust = checks
+	}
+
+	return options
+}
+
+// makeAttesters defaults to the keys the keyring trusts.
+func makeAttesters() []pkgthing.KeyReference {
+	keys := parseKeyReferences(attesterKeys)
+
+	if len(keys) == 0 {
+		keys = trustedKeyringKeys()
+	}
+
+	if len(keys) == 0 {
+		die(fmt.Errorf("--require-attestations needs --attesters or trusted keys in the keyring"))
+	}
+
+	return keys
+}
+
+// makePromoters defaults to the keys the keyring trusts.
+func makePromoters() []pkgthing.KeyReference {
+	keys := parseKeyReferences(promoterKeys)
+
+	if len(keys) == 0 {
+		keys = trustedKeyringKeys()
+	}
+
+	return keys
+}
+
+func makeConflictPolicy() pkgthing.ConflictPolicy {
+	switch conflictPolicy {
+	case __NEWEST_POLICY:
+		return pkgthing.NewestPolicy{}
+	case __TRUSTED_POLICY:
+		keys := parseKeyReferences(trustedKeys)
+
+		if len(keys) == 0 {
+			keyring := readKeyring()
+			keys = keyring.TrustedKeys()
+		}
+
+		return pkgthing.TrustedKeyPolicy{
+			Keys: keys,
+		}
+	default:
+		die(fmt.Errorf("Unknown conflict policy: %s", conflictPolicy))
+		return nil
+	}
+}
+
+// trustedKeyringKeys are the keys the keyring trust policy names.
+func trustedKeyringKeys() []pkgthing.KeyReference {
+	keyring := readKeyring()
+	return keyring.TrustedKeys()
+}
+
+func parseKeyReferences(texts []string) []pkgthing.KeyReference {
+	keys := make([]pkgthing.KeyReference, 0, len(texts))
+
+	for _, text := range texts {
+		key, err := pkgthing.ParseKeyReference(text)
+
+		if err != nil {
+			die(err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys
 }
 
 func die(err error) {
@@ -83,6 +327,57 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&ipfsUrl, "ipfs", DEFAULT_IPFS_URL, "IPFS API URL")
 	RootCmd.PersistentFlags().StringVar(&godlessUrl, "godless", DEFAULT_GODLESS_URL, "Godless API URL")
 	RootCmd.PersistentFlags().StringVar(&system, "system", DEFAULT_SYSTEM, "Computer system")
+	RootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", defaultCacheDir(), "Package cache directory (empty to disable)")
+	RootCmd.PersistentFlags().Int64Var(&cacheSize, "cache-size", DEFAULT_CACHE_SIZE, "Package cache size in megabytes")
+	RootCmd.PersistentFlags().DurationVar(&searchCacheTTL, "search-ttl", DEFAULT_SEARCH_TTL, "How long to cache search results")
+	RootCmd.PersistentFlags().IntVar(&chunkThreshold, "chunk-threshold", DEFAULT_CHUNK_THRESHOLD, "Split packages larger than this many megabytes into chunks (0 to disable)")
+	RootCmd.PersistentFlags().StringVar(&chunkDir, "chunk-dir", defaultChunkDir(), "Directory recording transferred chunks (empty to disable resume)")
+	RootCmd.PersistentFlags().BoolVar(&useDeltas, "deltas", false, "Publish deltas against the previous version of each package")
+	RootCmd.PersistentFlags().StringVar(&compression, "compression", pkgthing.NO_COMPRESSION, "Compress added packages with 'zstd' or 'xz'")
+	RootCmd.PersistentFlags().StringVar(&keyringFile, "keyring", defaultKeyringFile(), "Keyring file")
+	RootCmd.PersistentFlags().BoolVar(&ignoreTrust, "ignore-trust", false, "Do not enforce the keyring trust policy")
+	RootCmd.PersistentFlags().BoolVar(&logPublications, "transparency-log", true, "Record every add in the transparency log")
+	RootCmd.PersistentFlags().IntVar(&requiredAttestations, "require-attestations", 0, "Independent attestations required to get a package")
+	RootCmd.PersistentFlags().StringVar(&attestationClaim, "attestation-claim", pkgthing.REPRODUCIBLE_BUILD_CLAIM, "Claim that required attestations must make")
+	RootCmd.PersistentFlags().StringSliceVar(&attesterKeys, "attesters", nil, "Only count attestations from these keys (default: keys the keyring trusts)")
+	RootCmd.PersistentFlags().StringVar(&conflictPolicy, "conflict-policy", __NEWEST_POLICY, "How to choose between conflicting publications: 'newest' or 'trusted'")
+	RootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Least severe log level shown: 'debug', 'info', 'warn' or 'error'")
+	RootCmd.PersistentFlags().StringVar(&logFormat, "log-format", __TEXT_LOG_FORMAT, "Log format: 'text' or 'json'")
+	RootCmd.PersistentFlags().BoolVar(&showProgress, "progress", true, "Show progress when stderr is a terminal")
+	RootCmd.PersistentFlags().StringSliceVar(&promoterKeys, "promoters", nil, "Only count channel promotions signed by these keys (default: keys the keyring trusts)")
+	RootCmd.PersistentFlags().StringSliceVar(&trustedKeys, "trusted-keys", nil, "Keys trusted by the 'trusted' conflict policy (default keyring trusted keys)")
+}
+
+func defaultKeyringFile() string {
+	return userConfigPath("keyring.json")
+}
+
+func userConfigPath(name string) string {
+	dir, err := os.UserHomeDir()
+
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, ".pkgthing", name)
+}
+
+func defaultCacheDir() string {
+	return userCachePath("blobs")
+}
+
+func defaultChunkDir() string {
+	return userCachePath("chunks")
+}
+
+func userCachePath(name string) string {
+	dir, err := os.UserCacheDir()
+
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "pkgthing", name)
 }
 
 // TODO should live in godless
@@ -92,6 +387,19 @@ const DEFAULT_IPFS_URL = "http://localhost:5001"
 
 const DEFAULT_SYSTEM = ""
 
+const DEFAULT_CACHE_SIZE = 1024
+
+const DEFAULT_SEARCH_TTL = time.Minute
+
+const DEFAULT_CHUNK_THRESHOLD = 16
+
+const __MEGABYTE = 1 << 20
+
+const __NEWEST_POLICY = "newest"
+const __TRUSTED_POLICY = "trusted"
+
+const __DEFAULT_KEY_NAME = "default"
+
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	if cfgFile != "" { // enable ability to specify config file via flag
@@ -60,6 +60,7 @@ var searchCmd = &cobra.Command{
 
 var searchTerm string
 var searchKeyText string
+var searchKeys []string
 
 func validateSearchArgs() {
 	if searchTerm == "" || searchKeyText == "" {
@@ -77,9 +78,12 @@ func validateSearchArgs() {
 
 func makeSearchTerm(searchKey pkgthing.SearchKey) pkgthing.PackageSearchTerm {
 	return pkgthing.PackageSearchTerm{
-		System:     system,
-		SearchTerm: searchTerm,
-		SearchKey:  searchKey,
+		System:        system,
+		SearchTerm:    searchTerm,
+		SearchKey:     searchKey,
+		IncludeYanked: includeYanked,
+		Keys:          parseKeyReferences(searchKeys),
+		Channel:       channel,
 	}
 }
 
@@ -89,4 +93,7 @@ func init() {
 	searchCmd.PersistentFlags().StringVar(&system, "system", DEFAULT_SYSTEM, "Computer system")
 	searchCmd.PersistentFlags().StringVar(&searchTerm, "term", "", "Search term")
 	searchCmd.PersistentFlags().StringVar(&searchKeyText, "field", "name", "Search field")
+	searchCmd.PersistentFlags().BoolVar(&includeYanked, "include-yanked", false, "Include yanked packages")
+	searchCmd.PersistentFlags().StringVar(&channel, "channel", "", "Only show packages in this channel")
+	searchCmd.PersistentFlags().StringSliceVar(&searchKeys, "signed-by", nil, "Only show packages signed by one of these keys")
 }
@@ -0,0 +1,110 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// serveAptCmd represents the serve-apt command
+var serveAptCmd = &cobra.Command{
+	Use:   "serve-apt",
+	Short: "Serve a pkgthing system as an APT repository",
+	Long: `Serve a pkgthing system as an APT repository.
+
+Point apt at the server with a sources.list line such as:
+
+  deb http://localhost:8086 pkgthing main
+
+The Release file is signed with your default key, as an OpenPGP EdDSA key
+that APT understands. Its public half is served at /pubkey.gpg. With
+--unsigned the repository must be marked [trusted=yes].`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateServeAptArgs()
+
+		thing := makePkgthing()
+		repo := pkgthing.AptRepository{
+			Searcher:        thing,
+			Getter:          thing,
+			System:          serveAptSystem,
+			Suite:           serveAptSuite,
+			Component:       serveAptComponent,
+			Origin:          serveAptOrigin,
+			RefreshInterval: serveAptRefresh,
+			Logger:          makeLogger(),
+		}
+
+		if !serveAptUnsigned {
+			key, err := pkgthing.MakeAptSigningKey(loadSigningKey(), serveAptOrigin)
+
+			if err != nil {
+				die(err)
+			}
+
+			repo.SigningKey = key
+		}
+
+		makeLogger().Log(pkgthing.LOG_INFO, "Serving APT repository", pkgthing.LogField{Key: "system", Value: serveAptSystem}, pkgthing.LogField{Key: "addr", Value: serveAptAddr})
+		err := http.ListenAndServe(serveAptAddr, repo.Handler())
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+var serveAptAddr string
+var serveAptSystem string
+var serveAptSuite string
+var serveAptComponent string
+var serveAptOrigin string
+var serveAptUnsigned bool
+var serveAptRefresh time.Duration
+
+func validateServeAptArgs() {
+	if serveAptAddr == "" {
+		die(errors.New("Must supply addr"))
+	}
+
+	if serveAptSystem == "" {
+		die(errors.New("Must supply system"))
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(serveAptCmd)
+
+	ubuntu := &pkgthing.Ubuntu{}
+
+	serveAptCmd.PersistentFlags().StringVar(&serveAptAddr, "addr", "localhost:8086", "Address to listen on")
+	serveAptCmd.PersistentFlags().StringVar(&serveAptSystem, "system", ubuntu.SystemName(), "System to serve")
+	serveAptCmd.PersistentFlags().StringVar(&serveAptSuite, "suite", "pkgthing", "Suite name")
+	serveAptCmd.PersistentFlags().StringVar(&serveAptComponent, "component", "main", "Component name")
+	serveAptCmd.PersistentFlags().StringVar(&serveAptOrigin, "origin", "pkgthing", "Origin and Label of the Release file")
+	serveAptCmd.PersistentFlags().BoolVar(&serveAptUnsigned, "unsigned", false, "Do not sign the Release file")
+	serveAptCmd.PersistentFlags().DurationVar(&serveAptRefresh, "refresh", time.Minute, "How often to rebuild the package index")
+}
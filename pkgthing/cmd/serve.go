@@ -0,0 +1,142 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the package index over an HTTP JSON API",
+	Long: `Serve the package index over an HTTP JSON API.
+
+Endpoints:
+
+  GET  /api/search?system=&field=name|system&term=&include_yanked=true&channel=
+  GET  /api/packages/<system>/<name>/info[?path=]
+  GET  /api/packages/<system>/<name>[?path=]
+  POST /api/packages/<system>/<name>?meta.<key>=<value>
+  GET  /api/blobs/<hash>
+  POST /api/blobs
+  GET  /api/sync
+  POST /api/sync
+
+Sync endpoints are only enabled with --sync-ubuntu.
+
+POST requests must send the contents of --token-file as a bearer token, and
+are signed with your default key. Without --token-file the server is read
+only.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateServeArgs()
+
+		token := readServeToken()
+
+		var thing pkgthing.PackageManager
+		if token == "" {
+			thing = makePkgthing()
+		} else {
+			thing = makeSigningPkgthing()
+		}
+
+		server := pkgthing.Server{
+			Manager: thing,
+			Store:   makeStorage(),
+			MaxSize: serveMaxSize,
+			Token:   token,
+			Logger:  makeLogger(),
+		}
+
+		if serveSyncUbuntu {
+			ubuntu := makeUbuntu()
+			server.Syncer = &pkgthing.Syncer{
+				Adder:  thing,
+				Getter: ubuntu,
+				Lister: ubuntu,
+				Logger: makeLogger(),
+			}
+			addSyncStages(server.Syncer, thing)
+		}
+
+		makeLogger().Log(pkgthing.LOG_INFO, "Serving", pkgthing.LogField{Key: "addr", Value: serveAddr})
+		err := http.ListenAndServe(serveAddr, server.Handler())
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+var serveAddr string
+var serveSyncUbuntu bool
+var serveMaxSize int64
+var serveTokenFile string
+
+func validateServeArgs() {
+	if serveAddr == "" {
+		die(errors.New("Must supply addr"))
+	}
+
+	if serveSyncUbuntu && serveTokenFile == "" {
+		die(errors.New("--sync-ubuntu requires --token-file"))
+	}
+}
+
+func readServeToken() string {
+	if serveTokenFile == "" {
+		return ""
+	}
+
+	text, err := ioutil.ReadFile(serveTokenFile)
+
+	if err != nil {
+		die(err)
+	}
+
+	token := strings.TrimSpace(string(text))
+
+	if token == "" {
+		die(errors.New("Token file is empty"))
+	}
+
+	return token
+}
+
+func init() {
+	RootCmd.AddCommand(serveCmd)
+
+	serveCmd.PersistentFlags().StringVar(&serveAddr, "addr", __DEFAULT_SERVE_ADDR, "Address to listen on")
+	serveCmd.PersistentFlags().StringVar(&serveTokenFile, "token-file", "", "File containing the bearer token that allows POST requests")
+	serveCmd.PersistentFlags().BoolVar(&serveSyncUbuntu, "sync-ubuntu", false, "Allow syncing the local Ubuntu packages through the API")
+	addSyncStageFlags(serveCmd)
+	serveCmd.PersistentFlags().Int64Var(&serveMaxSize, "max-upload-size", 1<<30, "Maximum upload size in bytes")
+}
+
+// The godless API listens on 8085 by default.
+const __DEFAULT_SERVE_ADDR = "localhost:8086"
@@ -0,0 +1,121 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Record the installed packages of an Ubuntu system",
+	Run: func(cmd *cobra.Command, args []string) {
+		snapper := pkgthing.Snapshotter{
+			Lister:   makeUbuntu(),
+			Searcher: makePkgthing(),
+		}
+
+		snap, err := snapper.TakeSnapshot()
+
+		if err != nil {
+			die(err)
+		}
+
+		hash, err := pkgthing.SaveSnapshot(makeStorage(), makeSnapshotIndex(), snap)
+
+		if err != nil {
+			die(err)
+		}
+
+		fmt.Println(hash)
+	},
+}
+
+// snapshotRestoreCmd represents the snapshot restore command
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Install the packages recorded in a snapshot",
+	Run: func(cmd *cobra.Command, args []string) {
+		validateSnapshotRestoreArgs()
+
+		snap := loadSnapshot(snapshotHash)
+		manifest := snap.Manifest()
+
+		missing := len(snap.Packages) - len(manifest.Packages)
+		if missing > 0 {
+			makeLogger().Log(pkgthing.LOG_WARN, "Skipping packages that were not in pkgthing", pkgthing.LogField{Key: "count", Value: missing})
+		}
+
+		thing := makePkgthing()
+		locker := pkgthing.Locker{
+			Searcher: thing,
+			Getter:   thing,
+		}
+
+		lock, err := locker.Lock(manifest)
+
+		if err != nil {
+			die(err)
+		}
+
+		applier := pkgthing.Applier{
+			Getter:    thing,
+			Installer: makeUbuntu(),
+		}
+
+		err = applier.Apply(lock)
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+var snapshotHash string
+
+func validateSnapshotRestoreArgs() {
+	if snapshotHash == "" {
+		die(errors.New("Must supply hash"))
+	}
+}
+
+func loadSnapshot(hash string) pkgthing.Snapshot {
+	snap, err := pkgthing.LoadSnapshot(makeStorage(), hash)
+
+	if err != nil {
+		die(err)
+	}
+
+	return snap
+}
+
+func init() {
+	RootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+
+	snapshotRestoreCmd.PersistentFlags().StringVar(&snapshotHash, "hash", "", "Snapshot hash")
+}
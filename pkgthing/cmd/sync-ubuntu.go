@@ -21,6 +21,12 @@
 package cmd
 
 import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
 	"github.com/spf13/cobra"
 
 	"github.com/johnny-morrice/pkgthing"
@@ -30,15 +36,30 @@ import (
 var syncUbuntu = &cobra.Command{
 	Use:   "ubuntu",
 	Short: "Add all packages installed on an Ubuntu system",
+	Long: `Add all packages installed on an Ubuntu system.
+
+With --watch the command keeps running. It syncs once, then again whenever the
+dpkg status file changes and has settled, publishing only packages that are
+new or upgraded since the last sync. To sync from a dpkg hook instead, point
+--watch-file at a file touched by a DPkg::Post-Invoke hook.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		ubuntu := &pkgthing.Ubuntu{}
-		thing := makePkgthing()
+		ubuntu := makeUbuntu()
+		thing := makeSigningPkgthing()
 
 		syncer := pkgthing.Syncer{
-			Adder:  thing,
-			Getter: ubuntu,
-			Lister: ubuntu,
+			Adder:    thing,
+			Getter:   ubuntu,
+			Lister:   ubuntu,
+			Observer: makeObserver(),
+			Logger:   makeLogger(),
+		}
+		addSyncStages(&syncer, thing)
+
+		if syncWatch {
+			watchUbuntu(syncer)
+			return
 		}
+
 		err := syncer.AddAllPackages()
 
 		if err != nil {
@@ -47,6 +68,50 @@ var syncUbuntu = &cobra.Command{
 	},
 }
 
+var syncWatch bool
+var syncWatchFile string
+var syncWatchState string
+var syncWatchInterval time.Duration
+var syncDebounce time.Duration
+
+func watchUbuntu(syncer pkgthing.Syncer) {
+	// Ubuntu changes directory while repacking.
+	state, err := filepath.Abs(syncWatchState)
+
+	if err != nil {
+		die(err)
+	}
+
+	watcher := pkgthing.Watcher{
+		Syncer:    syncer,
+		Path:      syncWatchFile,
+		StateFile: state,
+		Interval:  syncWatchInterval,
+		Debounce:  syncDebounce,
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	err = watcher.Watch(stop)
+
+	if err != nil {
+		die(err)
+	}
+}
+
 func init() {
 	syncCmd.AddCommand(syncUbuntu)
+
+	syncUbuntu.PersistentFlags().BoolVar(&syncWatch, "watch", false, "Keep running, syncing new and upgraded packages as they are installed")
+	syncUbuntu.PersistentFlags().StringVar(&syncWatchFile, "watch-file", "/var/lib/dpkg/status", "File that changes when packages are installed")
+	syncUbuntu.PersistentFlags().StringVar(&syncWatchState, "watch-state", userConfigPath("ubuntu-watch.json"), "File recording the packages already synced")
+	syncUbuntu.PersistentFlags().DurationVar(&syncWatchInterval, "watch-interval", 5*time.Second, "How often to check the watched file")
+	syncUbuntu.PersistentFlags().DurationVar(&syncDebounce, "debounce", 10*time.Second, "How long the watched file must be unchanged before syncing")
 }
@@ -22,6 +22,8 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+
+	"github.com/johnny-morrice/pkgthing"
 )
 
 // syncCmd represents the sync command
@@ -30,6 +32,116 @@ var syncCmd = &cobra.Command{
 	Short: "Add all packages installed on your system",
 }
 
+var syncInclude []string
+var syncExclude []string
+var syncRequireMeta []string
+var syncExcludeMeta []string
+var syncSetMeta []string
+var syncSkipExisting bool
+var syncAttestClaim string
+var syncCoSignKeys []string
+
+// addSyncStageFlags registers the flags read by addSyncStages on commands that
+// run a Syncer.
+func addSyncStageFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringSliceVar(&syncInclude, "include", nil, "Only sync packages whose name matches a glob")
+	cmd.PersistentFlags().StringSliceVar(&syncExclude, "exclude", nil, "Skip packages whose name matches a glob")
+	cmd.PersistentFlags().StringSliceVar(&syncRequireMeta, "require-meta", nil, "Only sync packages with key=glob metadata")
+	cmd.PersistentFlags().StringSliceVar(&syncExcludeMeta, "exclude-meta", nil, "Skip packages with key=glob metadata")
+	cmd.PersistentFlags().StringSliceVar(&syncSetMeta, "set-meta", nil, "Set key=value metadata on every package")
+	cmd.PersistentFlags().BoolVar(&syncSkipExisting, "skip-existing", false, "Skip packages already published with the same version and architecture")
+	cmd.PersistentFlags().StringVar(&syncAttestClaim, "attest", "", "Attest this claim for every synced package")
+	cmd.PersistentFlags().StringSliceVar(&syncCoSignKeys, "cosign", nil, "Also sign every synced package with these keyring keys")
+}
+
+func addSyncStages(syncer *pkgthing.Syncer, thing pkgthing.PackageManager) {
+	if len(syncInclude) > 0 || len(syncExclude) > 0 {
+		syncer.Filters = append(syncer.Filters, pkgthing.NameFilter{
+			Include: syncInclude,
+			Exclude: syncExclude,
+		})
+	}
+
+	for _, text := range syncRequireMeta {
+		syncer.Filters = append(syncer.Filters, parseMetaDataFilter(text, false))
+	}
+
+	for _, text := range syncExcludeMeta {
+		syncer.Filters = append(syncer.Filters, parseMetaDataFilter(text, true))
+	}
+
+	if syncSkipExisting {
+		syncer.Filters = append(syncer.Filters, &pkgthing.Deduplicator{
+			Searcher: thing,
+		})
+	}
+
+	if len(syncSetMeta) > 0 {
+		enricher := pkgthing.MetaDataEnricher{}
+		for _, text := range syncSetMeta {
+			entry, err := pkgthing.ParseMetaDataEntry(text)
+
+			if err != nil {
+				die(err)
+			}
+
+			enricher.MetaData = append(enricher.MetaData, entry)
+		}
+
+		syncer.Transforms = append(syncer.Transforms, enricher)
+	}
+
+	if syncAttestClaim != "" {
+		syncer.Hooks = append(syncer.Hooks, pkgthing.AttestingHook{
+			Attester: thing,
+			Claim:    syncAttestClaim,
+		})
+	}
+
+	for _, name := range syncCoSignKeys {
+		syncer.Hooks = append(syncer.Hooks, makeCoSigningHook(name))
+	}
+}
+
+// makeCoSigningHook signs with the named keyring key, rather than the
+// default key the Adder signs with.
+func makeCoSigningHook(name string) pkgthing.CoSigningHook {
+	keyring := readKeyring()
+	entry, err := keyring.Lookup(name)
+
+	if err != nil {
+		die(err)
+	}
+
+	key, err := entry.PrivateKey()
+
+	if err != nil {
+		die(err)
+	}
+
+	options := makeOptions()
+	options.Signer = key
+
+	hook := pkgthing.CoSigningHook{
+		CoSigner: pkgthing.New(options).(pkgthing.PackageCoSigner),
+		Key:      key.Reference(),
+	}
+
+	return hook
+}
+
+func parseMetaDataFilter(text string, exclude bool) pkgthing.MetaDataFilter {
+	filter, err := pkgthing.ParseMetaDataFilter(text, exclude)
+
+	if err != nil {
+		die(err)
+	}
+
+	return filter
+}
+
 func init() {
 	RootCmd.AddCommand(syncCmd)
+
+	addSyncStageFlags(syncCmd)
 }
@@ -0,0 +1,70 @@
+// Copyright © 2017 Johnny Morrice <john@functorama.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// yankCmd represents the yank command
+var yankCmd = &cobra.Command{
+	Use:   "yank",
+	Short: "Withdraw a published package",
+	Long: `Withdraw a published package.
+
+Yanks are signed with your default key. They are only honoured when that key
+signed the yanked publication, or when the reader's keyring trusts it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateYankArgs()
+
+		info := makePackageInfo()
+		info.IpfsPath = yankPath
+
+		pkgthing := makeSigningPkgthing()
+		err := pkgthing.Yank(info, yankReason)
+
+		if err != nil {
+			die(err)
+		}
+	},
+}
+
+var yankPath string
+var yankReason string
+
+func validateYankArgs() {
+	ok := name != ""
+	ok = ok && system != ""
+	ok = ok && yankReason != ""
+
+	if !ok {
+		die(errors.New("Must supply name, system, and reason"))
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(yankCmd)
+
+	yankCmd.PersistentFlags().StringVar(&name, "name", "", "Package name")
+	yankCmd.PersistentFlags().StringVar(&yankPath, "path", "", "IPFS path of the version to yank (default current)")
+	yankCmd.PersistentFlags().StringVar(&yankReason, "reason", "", "Reason for yanking")
+}
@@ -0,0 +1,36 @@
+package pkgthing
+
+import (
+	"testing"
+)
+
+func TestChooseCandidateSharingBlob(t *testing.T) {
+	publisher := testKey(t)
+	forger := testKey(t)
+
+	genuine := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	genuine.MetaData = append(genuine.MetaData, MetaDataEntry{MetaDataKey: COMPRESSION_KEY, MetaDataValue: ZSTD_COMPRESSION})
+	genuine = testPublish(t, genuine, publisher)
+	genuine.IpfsPath = "bash-path"
+
+	forged := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	forged.MetaData = append(forged.MetaData, MetaDataEntry{MetaDataKey: COMPRESSION_KEY, MetaDataValue: XZ_COMPRESSION})
+	forged = testPublish(t, forged, forger)
+	forged.IpfsPath = "bash-path"
+
+	thing := New(Options{
+		Trust: TrustPolicy{Rules: []TrustRule{
+			{System: "*", Name: "*", Keys: []string{publisher.Reference().String()}},
+		}},
+	}).(*pkgthing)
+
+	chosen, err := thing.chooseCandidate(genuine, []PackageInfo{forged, genuine})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if method := chosen.GetMetaData(COMPRESSION_KEY); method != ZSTD_COMPRESSION {
+		t.Errorf("Expected the trusted publication's compression but got '%s'", method)
+	}
+}
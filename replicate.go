@@ -0,0 +1,197 @@
+package pkgthing
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// IndexMirror copies the packages of one system from the Source index to the
+// Dest index. Run it through a Syncer, using the mirror as Lister, Getter,
+// Adder and first Filter; MakeSyncer does this.
+//
+// Without CopyBlobs only the index entries are copied, so both indexes must
+// share a CAS. With CopyBlobs the stored blobs are copied as they are from the
+// SourceStore to the DestStore, so each copy keeps its IpfsPath. A Dest that
+// is a PackageRepublisher records each publication with its original time
+// and signatures, adding its own signature alongside them; any other Dest
+// publishes a copy of its own, marked with MIRRORED_FROM_KEY. Packages already
+// mirrored are skipped, so runs are incremental. Yanked packages are copied
+// and then yanked again in the Dest with the same reason. Attestations and
+// promotions are not copied.
+type IndexMirror struct {
+	Source      PackageManager
+	Dest        PackageManager
+	System      string
+	CopyBlobs   bool
+	SourceStore ContentAddressableStorage
+	DestStore   ContentAddressableStorage
+}
+
+func (mirror IndexMirror) MakeSyncer() Syncer {
+	return Syncer{
+		Lister:  mirror,
+		Getter:  mirror,
+		Adder:   mirror,
+		Filters: []SyncFilter{mirror},
+	}
+}
+
+func (mirror IndexMirror) GetInstalledPackages() ([]PackageInfo, error) {
+	lister := SystemLister{
+		Searcher: mirror.Source,
+		System:   mirror.System,
+	}
+
+	allInfo, err := lister.GetAllCandidates()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "IndexMirror.GetInstalledPackages failed")
+	}
+
+	return allInfo, nil
+}
+
+func (mirror IndexMirror) Get(info PackageInfo) (Package, error) {
+	if mirror.CopyBlobs {
+		err := mirror.copyBlobs(info)
+
+		if err != nil {
+			return Package{}, errors.Wrap(err, "IndexMirror.Get failed")
+		}
+	}
+
+	// Yanks are kept for Add to yank the copy.
+	pack := Package{
+		PackageInfo: info,
+	}
+
+	pack.Attestations = nil
+	pack.Promotions = nil
+
+	return pack, nil
+}
+
+// copyBlobs copies the package blob, with its chunks and delta, from the
+// SourceStore to the DestStore.
+func (mirror IndexMirror) copyBlobs(info PackageInfo) error {
+	paths := []string{info.IpfsPath}
+
+	if isChunked(info) {
+		hashes, err := chunkHashes(mirror.SourceStore, info.IpfsPath)
+
+		if err != nil {
+			return err
+		}
+
+		paths = append(paths, hashes...)
+	}
+
+	if deltaPath := info.GetMetaData(DELTA_PATH_KEY); deltaPath != "" {
+		paths = append(paths, deltaPath)
+	}
+
+	for _, path := range paths {
+		err := mirror.copyBlob(path)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (mirror IndexMirror) copyBlob(path string) error {
+	reader, err := mirror.SourceStore.Cat(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	copied, err := mirror.DestStore.Add(reader)
+
+	if err != nil {
+		return err
+	}
+
+	if copied != path {
+		return fmt.Errorf("Blob '%s' was copied to '%s'", path, copied)
+	}
+
+	return nil
+}
+
+// Add publishes the package to the Dest, yanking it there too if it was
+// yanked in the Source.
+func (mirror IndexMirror) Add(pack Package) (PackageInfo, error) {
+	const errMsg = "IndexMirror.Add failed"
+
+	yanked := pack.IsYanked()
+	reason := pack.YankReason()
+	pack.Yanks = nil
+
+	info, err := mirror.publish(pack.PackageInfo)
+
+	if err != nil {
+		return PackageInfo{}, errors.Wrap(err, errMsg)
+	}
+
+	if yanked {
+		err = mirror.Dest.Yank(info, reason)
+
+		if err != nil {
+			return PackageInfo{}, errors.Wrap(err, errMsg)
+		}
+	}
+
+	return info, nil
+}
+
+func (mirror IndexMirror) publish(info PackageInfo) (PackageInfo, error) {
+	if republisher, ok := mirror.Dest.(PackageRepublisher); ok {
+		return republisher.Republish(info)
+	}
+
+	pack := Package{
+		PackageInfo: info.withMetaData(MIRRORED_FROM_KEY, info.IpfsPath),
+	}
+
+	return mirror.Dest.Add(pack)
+}
+
+func (mirror IndexMirror) StageName() string {
+	return "mirror"
+}
+
+// Keep skips packages the Dest already has, by IpfsPath or mirror origin.
+func (mirror IndexMirror) Keep(info PackageInfo) (bool, error) {
+	term := PackageSearchTerm{
+		SearchKey:     SEARCH_NAME,
+		SearchTerm:    info.Name,
+		System:        info.System,
+		IncludeYanked: true,
+	}
+
+	found, err := mirror.Dest.Search(term)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, other := range found {
+		if other.Name != info.Name {
+			continue
+		}
+
+		if other.IpfsPath == info.IpfsPath || other.GetMetaData(MIRRORED_FROM_KEY) == info.IpfsPath {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+const MIRRORED_FROM_KEY = "mirrored_from"
@@ -0,0 +1,219 @@
+package pkgthing
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestIndexMirrorYanksYankedPackages(t *testing.T) {
+	key := testKey(t)
+
+	bash := testPublish(t, testPackageInfo("ubuntu", "bash", "4.4", "amd64"), key)
+	bash.IpfsPath = "bash-path"
+
+	vim := testPublish(t, testPackageInfo("ubuntu", "vim", "7.4", "amd64"), key)
+	vim.IpfsPath = "vim-path"
+	vim.Yanks = []Yank{testYank(t, vim, key)}
+
+	source := &fakeManager{packages: []PackageInfo{bash, vim}}
+	dest := &fakeManager{}
+
+	mirror := IndexMirror{
+		Source: source,
+		Dest:   dest,
+		System: "ubuntu",
+	}
+
+	syncer := mirror.MakeSyncer()
+	err := syncer.AddAllPackages()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dest.packages) != 2 {
+		t.Fatalf("Expected 2 mirrored packages but got %d", len(dest.packages))
+	}
+
+	for _, info := range dest.packages {
+		if info.GetMetaData(MIRRORED_FROM_KEY) != info.IpfsPath {
+			t.Errorf("Expected '%s' to record its origin", info.Name)
+		}
+	}
+
+	if len(dest.yanked) != 1 || dest.yanked["vim"] != "broken" {
+		t.Errorf("Expected only vim to be yanked but got %v", dest.yanked)
+	}
+
+	err = syncer.AddAllPackages()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dest.packages) != 2 {
+		t.Errorf("Expected a second run to copy nothing but have %d packages", len(dest.packages))
+	}
+}
+
+func TestIndexMirrorKeepsPublisherSignatures(t *testing.T) {
+	publisher := testKey(t)
+
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	info.IpfsPath = "bash-path"
+	bash := testPublish(t, info, publisher)
+
+	source := &fakeManager{packages: []PackageInfo{bash}}
+	dest := &republishingManager{fakeManager: &fakeManager{}}
+
+	mirror := IndexMirror{
+		Source: source,
+		Dest:   dest,
+		System: "ubuntu",
+	}
+
+	syncer := mirror.MakeSyncer()
+	err := syncer.AddAllPackages()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dest.packages) != 1 {
+		t.Fatalf("Expected 1 mirrored package but got %d", len(dest.packages))
+	}
+
+	copied := dest.packages[0]
+
+	if copied.IpfsPath != bash.IpfsPath || !copied.Published.Equal(bash.Published) {
+		t.Error("Expected the original publication")
+	}
+
+	if copied.GetMetaData(MIRRORED_FROM_KEY) != "" {
+		t.Error("Expected the original metadata")
+	}
+
+	payload := publicationPayload(copied)
+	if !copied.IsSignedBy(publisher.Reference()) || !copied.Signatures[0].Verify(payload) {
+		t.Error("Expected the publisher's signature to be kept")
+	}
+
+	err = syncer.AddAllPackages()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dest.packages) != 1 {
+		t.Errorf("Expected a second run to copy nothing but have %d packages", len(dest.packages))
+	}
+}
+
+func TestIndexMirrorCopiesBlobsUnchanged(t *testing.T) {
+	sourceStore := makeMemoryStorage()
+	destStore := makeMemoryStorage()
+
+	thing := &pkgthing{Options: Options{Store: sourceStore}}
+	path, err := thing.addIpfsBlob(testRandomData(1, 1024))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	info.IpfsPath = path
+
+	dest := &republishingManager{fakeManager: &fakeManager{}}
+
+	mirror := IndexMirror{
+		Source:      &fakeManager{packages: []PackageInfo{info}},
+		Dest:        dest,
+		System:      "ubuntu",
+		CopyBlobs:   true,
+		SourceStore: sourceStore,
+		DestStore:   destStore,
+	}
+
+	syncer := mirror.MakeSyncer()
+	err = syncer.AddAllPackages()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !destStore.has(path) {
+		t.Error("Expected the blob to be copied")
+	}
+
+	if len(dest.packages) != 1 || dest.packages[0].IpfsPath != path {
+		t.Errorf("Expected the copy to keep its path but got %v", dest.packages)
+	}
+}
+
+// fakeManager is a PackageManager keeping packages in memory, without data.
+type fakeManager struct {
+	sync.Mutex
+	packages []PackageInfo
+	yanked   map[string]string
+}
+
+func (manager *fakeManager) Add(pack Package) (PackageInfo, error) {
+	manager.Lock()
+	defer manager.Unlock()
+
+	manager.packages = append(manager.packages, pack.PackageInfo)
+	return pack.PackageInfo, nil
+}
+
+func (manager *fakeManager) Get(info PackageInfo) (Package, error) {
+	return Package{PackageInfo: info}, nil
+}
+
+func (manager *fakeManager) Search(term PackageSearchTerm) ([]PackageInfo, error) {
+	manager.Lock()
+	defer manager.Unlock()
+
+	found := []PackageInfo{}
+	for _, info := range manager.packages {
+		if term.SearchKey == SEARCH_NAME && info.Name != term.SearchTerm {
+			continue
+		}
+
+		if !term.IncludeYanked && info.IsYanked() {
+			continue
+		}
+
+		found = append(found, info)
+	}
+
+	return found, nil
+}
+
+func (manager *fakeManager) Yank(info PackageInfo, reason string) error {
+	manager.Lock()
+	defer manager.Unlock()
+
+	if manager.yanked == nil {
+		manager.yanked = map[string]string{}
+	}
+
+	manager.yanked[info.Name] = reason
+	return nil
+}
+
+func (manager *fakeManager) Attest(info PackageInfo, claim string) error {
+	return nil
+}
+
+func (manager *fakeManager) Promote(info PackageInfo, from, to, approver string) error {
+	return nil
+}
+
+// republishingManager is a fakeManager that records publications as given.
+type republishingManager struct {
+	*fakeManager
+}
+
+func (manager *republishingManager) Republish(info PackageInfo) (PackageInfo, error) {
+	return manager.Add(Package{PackageInfo: info})
+}
@@ -0,0 +1,380 @@
+package pkgthing
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Server exposes a PackageManager over HTTP/JSON.
+//
+//	GET  /api/search?system=&field=name|system&term=&include_yanked=true&channel=
+//	GET  /api/packages/<system>/<name>/info[?path=]
+//	GET  /api/packages/<system>/<name>[?path=]     package data
+//	POST /api/packages/<system>/<name>?meta.<key>=  body is package data
+//	GET  /api/blobs/<hash>                         streamed from the CAS
+//	POST /api/blobs                                streamed to the CAS
+//	GET  /api/sync                                 sync progress
+//	POST /api/sync                                 start a sync, if Syncer is set
+//
+// POST requests must carry Token as a bearer token. Without a Token the
+// server is read only. Package data is streamed when the Manager is also a
+// PackageOpener, unless it is stored as a delta. Uploaded packages are
+// streamed to the Store and published as uploaded, without compression or
+// chunking. A caching Store streams through its cache files too.
+type Server struct {
+	Manager PackageManager
+	Store   ContentAddressableStorage
+	Syncer  *Syncer
+	MaxSize int64
+	Token   string
+	Logger  Logger
+}
+
+func (server Server) Handler() http.Handler {
+	if server.Syncer != nil && server.Syncer.Status == nil {
+		server.Syncer.Status = &SyncStatus{}
+	}
+
+	if server.MaxSize <= 0 {
+		server.MaxSize = __DEFAULT_MAX_UPLOAD_SIZE
+	}
+
+	server.Logger = useLogger(server.Logger)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(__API_PREFIX+"search", server.handleSearch)
+	mux.HandleFunc(__API_PREFIX+"packages/", server.handlePackage)
+	mux.HandleFunc(__API_PREFIX+"blobs", server.handleBlob)
+	mux.HandleFunc(__API_PREFIX+"blobs/", server.handleBlob)
+	mux.HandleFunc(__API_PREFIX+"sync", server.handleSync)
+	return mux
+}
+
+func (server Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	params := r.URL.Query()
+
+	field := params.Get("field")
+	if field == "" {
+		field = "name"
+	}
+
+	key, err := ParseSearchKey(field)
+
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	term := PackageSearchTerm{
+		SearchKey:     key,
+		SearchTerm:    params.Get("term"),
+		System:        params.Get("system"),
+		IncludeYanked: params.Get("include_yanked") == "true",
+		Channel:       params.Get("channel"),
+	}
+
+	if key == SEARCH_SYSTEM && term.System == "" {
+		term.System = term.SearchTerm
+	}
+
+	if term.System == "" {
+		httpError(w, http.StatusBadRequest, errors.New("Must specify system"))
+		return
+	}
+
+	found, err := server.Manager.Search(term)
+
+	if err != nil {
+		httpError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	writeJson(w, found, server.Logger)
+}
+
+func (server Server) handlePackage(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, __API_PREFIX+"packages/"), "/")
+
+	wantInfo := len(parts) == 3 && parts[2] == "info"
+	if len(parts) != 2 && !wantInfo {
+		http.NotFound(w, r)
+		return
+	}
+
+	info := PackageInfo{
+		System:   parts[0],
+		Name:     parts[1],
+		IpfsPath: r.URL.Query().Get("path"),
+	}
+
+	if info.System == "" || info.Name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if wantInfo {
+			http.NotFound(w, r)
+			return
+		}
+
+		if server.allowWrite(w, r) {
+			server.addPackage(w, r, info)
+		}
+
+		return
+	}
+
+	opener, ok := server.Manager.(PackageOpener)
+
+	if !ok {
+		server.sendPackage(w, info, wantInfo)
+		return
+	}
+
+	found, err := opener.Find(info)
+
+	if err != nil {
+		httpError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if wantInfo {
+		writeJson(w, found, server.Logger)
+		return
+	}
+
+	reader, err := opener.Open(found)
+
+	if err != nil {
+		httpError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	defer reader.Close()
+
+	w.Header().Set(__IPFS_PATH_HEADER, found.IpfsPath)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, err = io.Copy(w, reader)
+
+	if err != nil {
+		server.Logger.Log(LOG_WARN, "Failed to send package", packageFields(found, errorField(err))...)
+	}
+}
+
+// sendPackage serves a Manager that can only Get whole packages.
+func (server Server) sendPackage(w http.ResponseWriter, info PackageInfo, wantInfo bool) {
+	pack, err := server.Manager.Get(info)
+
+	if err != nil {
+		httpError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if wantInfo {
+		writeJson(w, pack.PackageInfo, server.Logger)
+		return
+	}
+
+	w.Header().Set(__IPFS_PATH_HEADER, pack.IpfsPath)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, err = w.Write(pack.Data)
+
+	if err != nil {
+		server.Logger.Log(LOG_WARN, "Failed to send package", packageFields(pack.PackageInfo, errorField(err))...)
+	}
+}
+
+func (server Server) addPackage(w http.ResponseWriter, r *http.Request, info PackageInfo) {
+	for key, values := range r.URL.Query() {
+		if !strings.HasPrefix(key, __META_PARAM_PREFIX) || len(values) == 0 {
+			continue
+		}
+
+		info = info.withMetaData(strings.TrimPrefix(key, __META_PARAM_PREFIX), values[0])
+	}
+
+	sum := sha256.New()
+	size := &byteCounter{}
+	body := io.TeeReader(http.MaxBytesReader(w, r.Body, server.MaxSize), io.MultiWriter(sum, size))
+	hash, err := server.Store.Add(body)
+
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// The blob is stored as uploaded, whatever encoding the client claims.
+	info = info.withoutEncoding()
+	info = info.withDataSum(hex.EncodeToString(sum.Sum(nil)), size.count)
+	info.IpfsPath = hash
+
+	pack := Package{
+		PackageInfo: info,
+	}
+
+	added, err := server.Manager.Add(pack)
+
+	if err != nil {
+		httpError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	writeJson(w, added, server.Logger)
+}
+
+func (server Server) handleBlob(w http.ResponseWriter, r *http.Request) {
+	hash := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, __API_PREFIX+"blobs"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && hash != "":
+		server.catBlob(w, hash)
+	case r.Method == http.MethodPost && hash == "":
+		if server.allowWrite(w, r) {
+			server.addBlob(w, r)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (server Server) catBlob(w http.ResponseWriter, hash string) {
+	reader, err := server.Store.Cat(hash)
+
+	if err != nil {
+		httpError(w, http.StatusNotFound, err)
+		return
+	}
+
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, err = io.Copy(w, reader)
+
+	if err != nil {
+		server.Logger.Log(LOG_WARN, "Failed to send blob", LogField{Key: "hash", Value: hash}, errorField(err))
+	}
+}
+
+func (server Server) addBlob(w http.ResponseWriter, r *http.Request) {
+	hash, err := server.Store.Add(http.MaxBytesReader(w, r.Body, server.MaxSize))
+
+	if err != nil {
+		httpError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	writeJson(w, map[string]string{"Hash": hash}, server.Logger)
+}
+
+func (server Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	if server.Syncer == nil {
+		httpError(w, http.StatusNotFound, errors.New("Sync is not enabled"))
+		return
+	}
+
+	status := server.Syncer.Status
+
+	if r.Method == http.MethodPost {
+		if !server.allowWrite(w, r) {
+			return
+		}
+
+		if !status.TryStart() {
+			httpError(w, http.StatusConflict, errors.New("Sync already running"))
+			return
+		}
+
+		go func() {
+			err := server.Syncer.AddAllPackages()
+
+			if err != nil {
+				server.Logger.Log(LOG_ERROR, "Sync failed", errorField(err))
+			}
+		}()
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	writeJson(w, status.Progress(), server.Logger)
+}
+
+// allowWrite checks the request's bearer token against Token.
+func (server Server) allowWrite(w http.ResponseWriter, r *http.Request) bool {
+	if server.Token == "" {
+		httpError(w, http.StatusForbidden, errors.New("Server is read only"))
+		return false
+	}
+
+	header := r.Header.Get("Authorization")
+	given := strings.TrimPrefix(header, __BEARER_PREFIX)
+
+	if given == header || subtle.ConstantTimeCompare([]byte(given), []byte(server.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		httpError(w, http.StatusUnauthorized, errors.New("Bad or missing token"))
+		return false
+	}
+
+	return true
+}
+
+type byteCounter struct {
+	count int64
+}
+
+func (counter *byteCounter) Write(p []byte) (int, error) {
+	counter.count += int64(len(p))
+	return len(p), nil
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJson(w http.ResponseWriter, value interface{}, logger Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(value)
+
+	if err != nil {
+		logger.Log(LOG_WARN, "Failed to write response", errorField(err))
+	}
+}
+
+func httpError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"Error": err.Error()})
+}
+
+const __API_PREFIX = "/api/"
+const __META_PARAM_PREFIX = "meta."
+const __IPFS_PATH_HEADER = "X-Pkgthing-Ipfs-Path"
+const __BEARER_PREFIX = "Bearer "
+const __DEFAULT_MAX_UPLOAD_SIZE = 1 << 30
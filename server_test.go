@@ -0,0 +1,55 @@
+package pkgthing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerRequiresToken(t *testing.T) {
+	for _, test := range []struct {
+		token    string
+		header   string
+		expected int
+	}{
+		{"", "Bearer secret", http.StatusForbidden},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "secret", http.StatusUnauthorized},
+		{"secret", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "Bearer secret", http.StatusOK},
+	} {
+		manager := &fakeManager{}
+		server := Server{Manager: manager, Store: makeMemoryStorage(), Token: test.token}
+
+		request := httptest.NewRequest(http.MethodPost, "/api/packages/ubuntu/bash?meta.compression=xz", strings.NewReader("bash"))
+		if test.header != "" {
+			request.Header.Set("Authorization", test.header)
+		}
+
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, request)
+
+		if recorder.Code != test.expected {
+			t.Errorf("Expected status %d with token '%s' and header '%s' but got %d", test.expected, test.token, test.header, recorder.Code)
+		}
+
+		if test.expected != http.StatusOK {
+			if len(manager.packages) != 0 {
+				t.Error("Expected rejected upload not to be added")
+			}
+
+			continue
+		}
+
+		if len(manager.packages) != 1 {
+			t.Fatalf("Expected upload to be added but got %v", manager.packages)
+		}
+
+		added := manager.packages[0]
+
+		if added.IpfsPath == "" || added.GetMetaData(COMPRESSION_KEY) != NO_COMPRESSION {
+			t.Errorf("Expected the uploaded blob to be added as stored but got %v", added)
+		}
+	}
+}
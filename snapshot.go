@@ -0,0 +1,213 @@
+package pkgthing
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/johnny-morrice/godless/api"
+	"github.com/johnny-morrice/godless/crdt"
+	"github.com/johnny-morrice/godless/query"
+	"github.com/pkg/errors"
+)
+
+type Snapshot struct {
+	Time     time.Time
+	Packages []PackageInfo
+}
+
+func (snap Snapshot) GetInstalledPackages() ([]PackageInfo, error) {
+	return snap.Packages, nil
+}
+
+// Manifest pins every snapshot package that was found in pkgthing.
+func (snap Snapshot) Manifest() Manifest {
+	manifest := Manifest{}
+
+	for _, info := range snap.Packages {
+		if info.IpfsPath == "" {
+			continue
+		}
+
+		entry := ManifestEntry{
+			System:   info.System,
+			Name:     info.Name,
+			Version:  info.GetMetaData(VERSION_KEY),
+			IpfsPath: info.IpfsPath,
+		}
+
+		manifest.Packages = append(manifest.Packages, entry)
+	}
+
+	return manifest
+}
+
+// SaveSnapshot stores snap and records its hash in the index, so that gc
+// keeps it.
+func SaveSnapshot(store ContentAddressableStorage, index SnapshotIndex, snap Snapshot) (string, error) {
+	const errMsg = "SaveSnapshot failed"
+
+	data, err := json.Marshal(snap)
+
+	if err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	hash, err := store.Add(bytes.NewReader(data))
+
+	if err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	err = index.AddSnapshot(hash)
+
+	if err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	return hash, nil
+}
+
+// SnapshotIndex records the hashes of saved snapshots.
+type SnapshotIndex interface {
+	AddSnapshot(hash string) error
+	Snapshots() ([]string, error)
+}
+
+// GodlessSnapshotIndex keeps the SnapshotIndex in a godless table, with a row
+// for each snapshot.
+type GodlessSnapshotIndex struct {
+	Godless api.Client
+}
+
+func (index GodlessSnapshotIndex) AddSnapshot(hash string) error {
+	entries := map[crdt.EntryName]crdt.PointText{
+		__SNAPSHOT_KEY: crdt.PointText(hash),
+	}
+
+	q := joinQuery(__SNAPSHOT_TABLE, hash, entries)
+	_, err := index.Godless.Send(api.MakeQueryRequest(q))
+
+	if err != nil {
+		return errors.Wrap(err, "GodlessSnapshotIndex.AddSnapshot failed")
+	}
+
+	return nil
+}
+
+func (index GodlessSnapshotIndex) Snapshots() ([]string, error) {
+	const errMsg = "GodlessSnapshotIndex.Snapshots failed"
+
+	q, err := query.Compile("select ??", __SNAPSHOT_TABLE)
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	resp, err := index.Godless.Send(api.MakeQueryRequest(q))
+
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	hashes := []string{}
+	resp.Namespace.ForeachRow(func(t crdt.TableName, r crdt.RowName, row crdt.Row) {
+		forEachPoint(row, __SNAPSHOT_KEY, func(text []byte) {
+			hashes = append(hashes, string(text))
+		})
+	})
+
+	return hashes, nil
+}
+
+func LoadSnapshot(store ContentAddressableStorage, hash string) (Snapshot, error) {
+	const errMsg = "LoadSnapshot failed"
+
+	reader, err := store.Cat(hash)
+
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, errMsg)
+	}
+
+	defer reader.Close()
+
+	snap := Snapshot{}
+	err = json.NewDecoder(reader).Decode(&snap)
+
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, errMsg)
+	}
+
+	return snap, nil
+}
+
+type Snapshotter struct {
+	Lister   PackageLister
+	Searcher PackageSearcher
+}
+
+func (snapper Snapshotter) TakeSnapshot() (Snapshot, error) {
+	const errMsg = "TakeSnapshot failed"
+
+	allInstalled, err := snapper.Lister.GetInstalledPackages()
+
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, errMsg)
+	}
+
+	published := map[string][]PackageInfo{}
+
+	snap := Snapshot{
+		Time:     time.Now().UTC(),
+		Packages: make([]PackageInfo, 0, len(allInstalled)),
+	}
+
+	for _, installed := range allInstalled {
+		found, ok := published[installed.System]
+
+		if !ok {
+			found, err = snapper.searchSystem(installed.System)
+
+			if err != nil {
+				return Snapshot{}, errors.Wrap(err, errMsg)
+			}
+
+			published[installed.System] = found
+		}
+
+		installed.IpfsPath = findIpfsPath(installed, found)
+		snap.Packages = append(snap.Packages, installed)
+	}
+
+	return snap, nil
+}
+
+func (snapper Snapshotter) searchSystem(system string) ([]PackageInfo, error) {
+	term := PackageSearchTerm{
+		SearchKey: SEARCH_SYSTEM,
+		System:    system,
+	}
+
+	return snapper.Searcher.Search(term)
+}
+
+func findIpfsPath(installed PackageInfo, published []PackageInfo) string {
+	version := installed.GetMetaData(VERSION_KEY)
+
+	for _, info := range published {
+		if info.Name != installed.Name {
+			continue
+		}
+
+		if version != "" && !info.HasMetaData(VERSION_KEY, version) {
+			continue
+		}
+
+		return info.IpfsPath
+	}
+
+	return ""
+}
+
+const __SNAPSHOT_TABLE = "pkgthing_snapshots"
+const __SNAPSHOT_KEY = "snapshot"
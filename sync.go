@@ -1,8 +1,8 @@
 package pkgthing
 
 import (
-	"log"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -13,6 +13,12 @@ type Syncer struct {
 	Adder             PackageAdder
 	GetterConcurrency int
 	AdderConcurrency  int
+	Status            *SyncStatus
+	Filters           []SyncFilter
+	Transforms        []SyncTransform
+	Hooks             []SyncHook
+	Observer          Observer
+	Logger            Logger
 }
 
 func (syncer Syncer) AddAllPackages() error {
@@ -26,12 +32,21 @@ func (syncer Syncer) AddAllPackages() error {
 		syncer.AdderConcurrency = __DEFAULT_ADDER_CONCURRENCY
 	}
 
+	logger := useLogger(syncer.Logger)
+
 	allInstalled, err := syncer.Lister.GetInstalledPackages()
 
 	if err != nil {
+		syncer.Status.finish(err)
+		notifyResult(syncer.Observer, Event{Operation: SYNC_OPERATION}, err)
 		return errors.Wrap(err, errMsg)
 	}
 
+	syncer.Status.start(len(allInstalled))
+
+	total := int64(len(allInstalled))
+	notify(syncer.Observer, Event{Operation: SYNC_OPERATION, Total: total})
+
 	wg := &sync.WaitGroup{}
 	getSem := makeSem(syncer.GetterConcurrency)
 	addSem := makeSem(syncer.AdderConcurrency)
@@ -43,10 +58,41 @@ func (syncer Syncer) AddAllPackages() error {
 			defer unlockSem(getSem)
 			defer wg.Done()
 
+			event := Event{
+				Operation: SYNC_PACKAGE_OPERATION,
+				Info:      info,
+				Total:     total,
+			}
+
+			notify(syncer.Observer, event)
+
+			err := syncer.keep(info)
+
+			if errors.Cause(err) == ErrSyncSkipped {
+				syncer.Status.skipped()
+				event.Kind = EVENT_SKIPPED
+				event.Err = err
+				notify(syncer.Observer, event)
+				return
+			}
+
+			if err != nil {
+				logger.Log(LOG_ERROR, "Failed to filter package", packageFields(info, errorField(err))...)
+				syncer.Status.failed(err)
+				notifyResult(syncer.Observer, event, err)
+				return
+			}
+
 			pkg, err := syncer.Getter.Get(info)
 
+			if err == nil {
+				pkg, err = syncer.transform(pkg)
+			}
+
 			if err != nil {
-				log.Printf("Failed to get package for '%v': %s", info, err.Error())
+				logger.Log(LOG_ERROR, "Failed to get package", packageFields(info, errorField(err))...)
+				syncer.Status.failed(err)
+				notifyResult(syncer.Observer, event, err)
 				return
 			}
 
@@ -55,23 +101,141 @@ func (syncer Syncer) AddAllPackages() error {
 				lockSem(addSem)
 				defer unlockSem(addSem)
 				defer wg.Done()
-				_, err = syncer.Adder.Add(pkg)
+				added, err := syncer.Adder.Add(pkg)
+
+				if err == nil {
+					err = syncer.runHooks(added)
+				}
 
 				if err != nil {
-					log.Printf("Failed to add package '%v': %s", info, err.Error())
+					logger.Log(LOG_ERROR, "Failed to add package", packageFields(info, errorField(err))...)
+					syncer.Status.failed(err)
+					event.Info = pkg.PackageInfo
+					notifyResult(syncer.Observer, event, err)
 					return
 				}
 
-				log.Printf("Synced package '%v'", info)
+				logger.Log(LOG_DEBUG, "Synced package", packageFields(added)...)
+				syncer.Status.succeeded()
+				event.Info = added
+				notifyResult(syncer.Observer, event, nil)
 			}()
 		}()
 	}
 
 	wg.Wait()
 
+	syncer.Status.finish(nil)
+	notifyResult(syncer.Observer, Event{Operation: SYNC_OPERATION, Total: total}, nil)
+
 	return nil
 }
 
+// SyncStatus tracks the progress of a Syncer. A nil *SyncStatus ignores
+// updates.
+type SyncStatus struct {
+	mutex    sync.Mutex
+	progress SyncProgress
+}
+
+type SyncProgress struct {
+	Running   bool
+	Started   time.Time
+	Finished  time.Time
+	Total     int
+	Synced    int
+	Skipped   int
+	Failed    int
+	LastError string
+}
+
+func (status *SyncStatus) Progress() SyncProgress {
+	if status == nil {
+		return SyncProgress{}
+	}
+
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	return status.progress
+}
+
+// TryStart marks a sync as running, returning false if one already is. A nil
+// *SyncStatus tracks nothing, so it always starts.
+func (status *SyncStatus) TryStart() bool {
+	if status == nil {
+		return true
+	}
+
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	if status.progress.Running {
+		return false
+	}
+
+	status.progress = SyncProgress{
+		Running: true,
+		Started: time.Now().UTC(),
+	}
+
+	return true
+}
+
+func (status *SyncStatus) start(total int) {
+	status.update(func(progress *SyncProgress) {
+		if !progress.Running {
+			*progress = SyncProgress{
+				Running: true,
+				Started: time.Now().UTC(),
+			}
+		}
+
+		progress.Total = total
+	})
+}
+
+func (status *SyncStatus) succeeded() {
+	status.update(func(progress *SyncProgress) {
+		progress.Synced++
+	})
+}
+
+func (status *SyncStatus) skipped() {
+	status.update(func(progress *SyncProgress) {
+		progress.Skipped++
+	})
+}
+
+func (status *SyncStatus) failed(err error) {
+	status.update(func(progress *SyncProgress) {
+		progress.Failed++
+		progress.LastError = err.Error()
+	})
+}
+
+func (status *SyncStatus) finish(err error) {
+	status.update(func(progress *SyncProgress) {
+		progress.Running = false
+		progress.Finished = time.Now().UTC()
+
+		if err != nil {
+			progress.LastError = err.Error()
+		}
+	})
+}
+
+func (status *SyncStatus) update(f func(progress *SyncProgress)) {
+	if status == nil {
+		return
+	}
+
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	f(&status.progress)
+}
+
 func makeSem(c int) chan struct{} {
 	return make(chan struct{}, c)
 }
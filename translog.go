@@ -0,0 +1,425 @@
+package pkgthing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/johnny-morrice/godless/api"
+	"github.com/johnny-morrice/godless/crdt"
+	"github.com/johnny-morrice/godless/query"
+	"github.com/pkg/errors"
+)
+
+// LogEntry records one publication. Entries are stored in the CAS and link
+// to the log heads they were appended to, so the log is a hash chain. Peers
+// appending concurrently fork the chain; the next append joins the forks.
+type LogEntry struct {
+	Previous  []string
+	Height    int
+	System    string
+	Name      string
+	IpfsPath  string
+	Time      time.Time
+	Signature Signature
+}
+
+func (entry LogEntry) payload() []byte {
+	text := fmt.Sprintf("log\n%s\n%d\n%s\n%s\n%s\n%s", strings.Join(entry.Previous, ","), entry.Height, entry.System, entry.Name, entry.IpfsPath, entry.Time.UTC().Format(time.RFC3339Nano))
+	return []byte(text)
+}
+
+// logHead records an entry as a head of the log. Heads are stored in one row
+// per height, so that finding the current heads reads a few small rows rather
+// than every head ever written. Heights are contiguous because each entry is
+// one higher than the heads it follows.
+type logHead struct {
+	Hash     string
+	Height   int
+	Previous []string
+}
+
+type TransparencyLog struct {
+	Store   ContentAddressableStorage
+	Godless api.Client
+}
+
+func (tlog TransparencyLog) Append(info PackageInfo, signer Signer) (string, error) {
+	const errMsg = "TransparencyLog.Append failed"
+
+	if signer == nil {
+		return "", errors.New(errMsg + ": no signing key")
+	}
+
+	heads, err := tlog.heads()
+
+	if err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	entry := LogEntry{
+		System:   info.System,
+		Name:     info.Name,
+		IpfsPath: info.IpfsPath,
+		Time:     time.Now().UTC(),
+	}
+
+	for _, head := range heads {
+		entry.Previous = append(entry.Previous, head.Hash)
+
+		if head.Height >= entry.Height {
+			entry.Height = head.Height + 1
+		}
+	}
+
+	sort.Strings(entry.Previous)
+
+	entry.Signature, err = signer.Sign(entry.payload())
+
+	if err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	encoded, err := json.Marshal(entry)
+
+	if err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	hash, err := tlog.Store.Add(bytes.NewReader(encoded))
+
+	if err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	head := logHead{
+		Hash:     hash,
+		Height:   entry.Height,
+		Previous: entry.Previous,
+	}
+
+	err = tlog.setHead(head)
+
+	if err != nil {
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	return hash, nil
+}
+
+type LoggedEntry struct {
+	LogEntry
+	Hash string
+}
+
+// Walk reads every entry reachable from the current heads, newest first.
+// Entries that cannot be read or whose signature is bad are returned
+// separately by hash.
+func (tlog TransparencyLog) Walk() ([]LoggedEntry, []string, error) {
+	heads, err := tlog.heads()
+
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "TransparencyLog.Walk failed")
+	}
+
+	entries := []LoggedEntry{}
+	bad := []string{}
+	seen := map[string]bool{}
+	queue := []string{}
+
+	for _, head := range heads {
+		queue = append(queue, head.Hash)
+	}
+
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+
+		if seen[hash] {
+			continue
+		}
+
+		seen[hash] = true
+
+		entry, err := tlog.readEntry(hash)
+
+		if err != nil || !entry.Signature.Verify(entry.payload()) {
+			bad = append(bad, hash)
+			continue
+		}
+
+		entries = append(entries, LoggedEntry{LogEntry: entry, Hash: hash})
+		queue = append(queue, entry.Previous...)
+	}
+
+	return entries, bad, nil
+}
+
+func (tlog TransparencyLog) readEntry(hash string) (LogEntry, error) {
+	reader, err := tlog.Store.Cat(hash)
+
+	if err != nil {
+		return LogEntry{}, err
+	}
+
+	defer reader.Close()
+
+	entry := LogEntry{}
+	err = json.NewDecoder(reader).Decode(&entry)
+	return entry, err
+}
+
+// heads returns the current heads of the log: those at the greatest height,
+// and any one lower that they do not follow, which an append that had not yet
+// seen them may have left behind.
+func (tlog TransparencyLog) heads() ([]logHead, error) {
+	top, err := tlog.topHeight(0)
+
+	if err != nil || top < 0 {
+		return nil, err
+	}
+
+	latest, err := tlog.headsAt(top)
+
+	if err != nil {
+		return nil, err
+	}
+
+	below := []logHead{}
+
+	if top > 0 {
+		below, err = tlog.headsAt(top - 1)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return unfollowedHeads(latest, below), nil
+}
+
+func (tlog TransparencyLog) topHeight(low int) (int, error) {
+	return searchTopHeight(low, func(height int) (bool, error) {
+		heads, err := tlog.headsAt(height)
+		return len(heads) > 0, err
+	})
+}
+
+// searchTopHeight finds the greatest height for which exists is true, given
+// that it is true for every height from low up to that one, or returns low-1
+// if it is false for low.
+func searchTopHeight(low int, exists func(int) (bool, error)) (int, error) {
+	ok, err := exists(low)
+
+	if err != nil || !ok {
+		return low - 1, err
+	}
+
+	// Gallop up to a missing height, then search between.
+	top := low
+	step := 1
+	for {
+		ok, err = exists(top + step)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if !ok {
+			break
+		}
+
+		top += step
+		step *= 2
+	}
+
+	missing := top + step
+	for missing-top > 1 {
+		middle := top + (missing-top)/2
+		ok, err = exists(middle)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			top = middle
+		} else {
+			missing = middle
+		}
+	}
+
+	return top, nil
+}
+
+func (tlog TransparencyLog) headsAt(height int) ([]logHead, error) {
+	return tlog.readHeads(headRowKey(height))
+}
+
+func (tlog TransparencyLog) readHeads(rowKey string) ([]logHead, error) {
+	q, err := query.Compile("select ?? where str_eq(@key, ?)", __LOG_TABLE, rowKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := tlog.Godless.Send(api.MakeQueryRequest(q))
+
+	if err != nil {
+		return nil, err
+	}
+
+	heads := []logHead{}
+	resp.Namespace.ForeachRow(func(t crdt.TableName, r crdt.RowName, row crdt.Row) {
+		if string(r) != rowKey {
+			return
+		}
+
+		forEachPoint(row, __LOG_HEAD_KEY, func(text []byte) {
+			head := logHead{}
+
+			if json.Unmarshal(text, &head) == nil {
+				heads = append(heads, head)
+			}
+		})
+	})
+
+	return heads, nil
+}
+
+func (tlog TransparencyLog) setHead(head logHead) error {
+	text, err := json.Marshal(head)
+
+	if err != nil {
+		return err
+	}
+
+	entries := map[crdt.EntryName]crdt.PointText{
+		__LOG_HEAD_KEY: crdt.PointText(text),
+	}
+
+	_, err = tlog.Godless.Send(api.MakeQueryRequest(joinQuery(__LOG_TABLE, headRowKey(head.Height), entries)))
+	return err
+}
+
+func headRowKey(height int) string {
+	return fmt.Sprintf("%s_%d", __LOG_HEAD_KEY, height)
+}
+
+// unfollowedHeads returns latest and those heads in below that no head in
+// latest follows.
+func unfollowedHeads(latest, below []logHead) []logHead {
+	followed := map[string]bool{}
+	for _, head := range latest {
+		for _, hash := range head.Previous {
+			followed[hash] = true
+		}
+	}
+
+	heads := append([]logHead{}, latest...)
+	for _, head := range below {
+		if !followed[head.Hash] {
+			heads = append(heads, head)
+		}
+	}
+
+	return heads
+}
+
+type AuditReport struct {
+	Entries    []LoggedEntry
+	BadEntries []string
+	Untrusted  []UntrustedEntry
+	Unlogged   []PackageInfo
+}
+
+// UntrustedEntry is a log entry whose signer the trust policy rejects.
+type UntrustedEntry struct {
+	LoggedEntry
+	Err error
+}
+
+func (report AuditReport) IsClean() bool {
+	return len(report.BadEntries) == 0 && len(report.Untrusted) == 0 && len(report.Unlogged) == 0
+}
+
+// Audit verifies the log and reports every package in systems that has no
+// log entry. When trust is not nil, entries whose signer it rejects are
+// reported as untrusted.
+func Audit(tlog TransparencyLog, searcher PackageSearcher, systems []string, trust SignatureChecker) (AuditReport, error) {
+	const errMsg = "Audit failed"
+
+	entries, bad, err := tlog.Walk()
+
+	if err != nil {
+		return AuditReport{}, errors.Wrap(err, errMsg)
+	}
+
+	report := AuditReport{
+		Entries:    entries,
+		BadEntries: bad,
+	}
+
+	if trust != nil {
+		report.Untrusted = untrustedEntries(entries, trust)
+	}
+
+	logged := map[string]bool{}
+	for _, entry := range entries {
+		logged[auditKey(entry.System, entry.Name, entry.IpfsPath)] = true
+	}
+
+	for _, system := range systems {
+		lister := SystemLister{
+			Searcher: searcher,
+			System:   system,
+		}
+
+		candidates, err := lister.GetAllCandidates()
+
+		if err != nil {
+			return AuditReport{}, errors.Wrap(err, errMsg)
+		}
+
+		for _, info := range candidates {
+			if !logged[auditKey(info.System, info.Name, info.IpfsPath)] {
+				report.Unlogged = append(report.Unlogged, info)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// untrustedEntries checks each entry's signer as if it had signed the package
+// the entry logs.
+func untrustedEntries(entries []LoggedEntry, trust SignatureChecker) []UntrustedEntry {
+	untrusted := []UntrustedEntry{}
+
+	for _, entry := range entries {
+		signed := PackageInfo{
+			System:     entry.System,
+			Name:       entry.Name,
+			IpfsPath:   entry.IpfsPath,
+			Signatures: []Signature{entry.Signature},
+		}
+
+		err := trust.Check(signed)
+
+		if err != nil {
+			untrusted = append(untrusted, UntrustedEntry{LoggedEntry: entry, Err: err})
+		}
+	}
+
+	return untrusted
+}
+
+func auditKey(system, name, path string) string {
+	return strings.Join([]string{system, name, normalizeHash(path)}, "\n")
+}
+
+const __LOG_TABLE = "pkgthing_log"
+const __LOG_HEAD_KEY = "head"
@@ -0,0 +1,107 @@
+package pkgthing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSearchTopHeight(t *testing.T) {
+	for _, expected := range []int{-1, 0, 1, 2, 5, 16, 17, 100} {
+		calls := 0
+		exists := func(height int) (bool, error) {
+			calls++
+			return height <= expected, nil
+		}
+
+		actual, err := searchTopHeight(0, exists)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual != expected {
+			t.Errorf("Expected top height %d but got %d", expected, actual)
+		}
+
+		if expected > 16 && calls > 20 {
+			t.Errorf("Expected a logarithmic search for %d but made %d calls", expected, calls)
+		}
+	}
+}
+
+func TestUnfollowedHeads(t *testing.T) {
+	below := []logHead{
+		{Hash: "a", Height: 3},
+		{Hash: "b", Height: 3},
+	}
+	latest := []logHead{
+		{Hash: "c", Height: 4, Previous: []string{"a"}},
+	}
+
+	heads := unfollowedHeads(latest, below)
+
+	if len(heads) != 2 || heads[0].Hash != "c" || heads[1].Hash != "b" {
+		t.Errorf("Expected heads c and b but got %v", heads)
+	}
+}
+
+func TestLogEntrySignatureCoversChain(t *testing.T) {
+	key := testKey(t)
+
+	entry := LogEntry{
+		Previous: []string{"a", "b"},
+		Height:   4,
+		System:   "ubuntu",
+		Name:     "bash",
+		IpfsPath: "bash-path",
+		Time:     time.Now().UTC(),
+	}
+
+	sig, err := key.Sign(entry.payload())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry.Signature = sig
+
+	if !entry.Signature.Verify(entry.payload()) {
+		t.Fatal("Expected entry signature to verify")
+	}
+
+	forked := entry
+	forked.Previous = []string{"a"}
+
+	if forked.Signature.Verify(forked.payload()) {
+		t.Error("Expected signature not to verify after the previous entries changed")
+	}
+}
+
+func TestUntrustedEntries(t *testing.T) {
+	trusted := testKey(t)
+	stranger := testKey(t)
+
+	policy := TrustPolicy{Rules: []TrustRule{
+		{System: "*", Name: "*", Keys: []string{trusted.Reference().String()}},
+	}}
+
+	entries := []LoggedEntry{}
+	for i, signer := range []Signer{trusted, stranger} {
+		entry := LogEntry{Height: i, System: "ubuntu", Name: "bash", IpfsPath: "bash-path"}
+		sig, err := signer.Sign(entry.payload())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entry.Signature = sig
+		entries = append(entries, LoggedEntry{LogEntry: entry, Hash: fmt.Sprintf("entry-%d", i)})
+	}
+
+	untrusted := untrustedEntries(entries, policy)
+
+	if len(untrusted) != 1 || untrusted[0].Hash != "entry-1" {
+		t.Errorf("Expected only the stranger's entry to be untrusted but got %v", untrusted)
+	}
+}
@@ -3,7 +3,6 @@ package pkgthing
 import (
 	"bytes"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
 	"strings"
@@ -12,6 +11,7 @@ import (
 )
 
 type Ubuntu struct {
+	Logger  Logger
 	tempDir string
 }
 
@@ -61,6 +61,28 @@ func (ubuntu *Ubuntu) Get(info PackageInfo) (Package, error) {
 	return pkg, nil
 }
 
+func (ubuntu *Ubuntu) InstallPackage(pack Package) error {
+	const errMsg = "Ubuntu.InstallPackage failed"
+
+	ubuntu.chdirTemp()
+
+	debFileName := ubuntu.debFileName(pack.PackageInfo)
+	err := ioutil.WriteFile(debFileName, pack.Data, __DEB_FILE_MODE)
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	cmd := exec.Command(__DPKG_COMMAND, __DPKG_INSTALL_ARG, debFileName)
+	err = cmd.Run()
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	return nil
+}
+
 func (ubuntu *Ubuntu) parseDpkgList(infoText []byte) ([]PackageInfo, error) {
 	lines := bytes.Split(infoText, []byte("\n"))
 
@@ -70,7 +92,7 @@ func (ubuntu *Ubuntu) parseDpkgList(infoText []byte) ([]PackageInfo, error) {
 		fields := bytes.Fields(l)
 		if len(fields) < __DPKG_FIELD_SIZE {
 			// TODO return error?
-			log.Printf("Missing fields from dpkg line: %s", string(l))
+			useLogger(ubuntu.Logger).Log(LOG_DEBUG, "Missing fields from dpkg line", LogField{Key: "line", Value: string(l)})
 			continue
 		}
 
@@ -137,11 +159,11 @@ func (ubuntu *Ubuntu) chdirTemp() {
 		err := os.Chdir(dirname)
 
 		if err != nil {
-			log.Print("Failed to change directory prior to repacking deb file")
+			useLogger(ubuntu.Logger).Log(LOG_WARN, "Failed to change directory prior to repacking deb file", errorField(err))
 			return
 		}
 	} else {
-		log.Print("Failed to create temporary directory prior to repacking deb file")
+		useLogger(ubuntu.Logger).Log(LOG_WARN, "Failed to create temporary directory prior to repacking deb file", errorField(err))
 		return
 	}
 
@@ -164,3 +186,5 @@ const __DPKG_IS_INSTALLED = "ii"
 const __DPKG_FIELD_SIZE = 4
 const __DPKG_COMMAND = "dpkg"
 const __DPKG_LIST_ARG = "-l"
+const __DPKG_INSTALL_ARG = "-i"
+const __DEB_FILE_MODE = 0644
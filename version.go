@@ -0,0 +1,132 @@
+package pkgthing
+
+import (
+	"strings"
+)
+
+// CompareVersions orders Debian package versions the way dpkg does, returning
+// -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	aEpoch, aUpstream, aRevision := splitVersion(a)
+	bEpoch, bUpstream, bRevision := splitVersion(b)
+
+	if c := compareNumeric(aEpoch, bEpoch); c != 0 {
+		return c
+	}
+
+	if c := compareVersionPart(aUpstream, bUpstream); c != 0 {
+		return c
+	}
+
+	return compareVersionPart(aRevision, bRevision)
+}
+
+func splitVersion(version string) (string, string, string) {
+	epoch := "0"
+	if i := strings.Index(version, ":"); i >= 0 {
+		epoch = version[:i]
+		version = version[i+1:]
+	}
+
+	revision := ""
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		revision = version[i+1:]
+		version = version[:i]
+	}
+
+	return epoch, version, revision
+}
+
+func compareVersionPart(a, b string) int {
+	for a != "" || b != "" {
+		var aText, bText string
+		aText, a = splitLeading(a, isNotDigit)
+		bText, b = splitLeading(b, isNotDigit)
+
+		if c := compareLexical(aText, bText); c != 0 {
+			return c
+		}
+
+		var aNum, bNum string
+		aNum, a = splitLeading(a, isDigit)
+		bNum, b = splitLeading(b, isDigit)
+
+		if c := compareNumeric(aNum, bNum); c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// compareLexical compares non-digit runs, with letters before non-letters
+// and '~' before everything, even the end of the string.
+func compareLexical(a, b string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		aOrder := lexicalOrder(a, i)
+		bOrder := lexicalOrder(b, i)
+
+		if aOrder != bOrder {
+			if aOrder < bOrder {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func lexicalOrder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+
+	c := s[i]
+
+	switch {
+	case c == '~':
+		return -1
+	case isLetter(c):
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+func compareNumeric(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
+
+func splitLeading(s string, pred func(byte) bool) (string, string) {
+	i := 0
+	for i < len(s) && pred(s[i]) {
+		i++
+	}
+
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNotDigit(c byte) bool {
+	return !isDigit(c)
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,33 @@
+package pkgthing
+
+import (
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.00", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1:1.0", "2.0", 1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0a", "1.0+", -1},
+		{"1.0", "1.0a", -1},
+		{"2.27-3ubuntu1", "2.27-3ubuntu1.2", -1},
+		{"1.2-3-4", "1.2-3", 1},
+	} {
+		if actual := CompareVersions(test.a, test.b); actual != test.expected {
+			t.Errorf("Expected CompareVersions(%s, %s) to be %d but got %d", test.a, test.b, test.expected, actual)
+		}
+
+		if actual := CompareVersions(test.b, test.a); actual != -test.expected {
+			t.Errorf("Expected CompareVersions(%s, %s) to be %d but got %d", test.b, test.a, -test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package pkgthing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Watcher runs a Syncer whenever a file changes, such as the dpkg status file,
+// syncing only packages that are new or have a new version since the last
+// run. What has been synced is kept in StateFile, so restarts do not repeat
+// work.
+type Watcher struct {
+	Syncer    Syncer
+	Path      string
+	StateFile string
+	// Interval is how often Path is checked for changes.
+	Interval time.Duration
+	// Debounce is how long Path must stay unchanged before syncing, so that
+	// a run of package installs is synced once.
+	Debounce time.Duration
+}
+
+// Watch syncs once, then again after each change, until stop is closed.
+func (watcher Watcher) Watch(stop <-chan struct{}) error {
+	const errMsg = "Watch failed"
+
+	if watcher.Interval <= 0 {
+		watcher.Interval = __DEFAULT_WATCH_INTERVAL
+	}
+
+	state, err := readWatchState(watcher.StateFile)
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	syncer := watcher.Syncer
+	syncer.Filters = append([]SyncFilter{state}, syncer.Filters...)
+	syncer.Hooks = append(syncer.Hooks, state)
+
+	last, err := watchStamp(watcher.Path)
+
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+
+	for {
+		err = syncer.AddAllPackages()
+
+		if err != nil {
+			useLogger(syncer.Logger).Log(LOG_ERROR, "Watch sync failed", errorField(err))
+		}
+
+		err = state.save(watcher.StateFile)
+
+		if err != nil {
+			return errors.Wrap(err, errMsg)
+		}
+
+		last, err = watcher.waitForChange(last, stop)
+
+		if err != nil {
+			return errors.Wrap(err, errMsg)
+		}
+
+		if last == "" {
+			return nil
+		}
+	}
+}
+
+// waitForChange returns the new stamp of Path once it has changed and then
+// settled, or "" once stop is closed.
+func (watcher Watcher) waitForChange(last string, stop <-chan struct{}) (string, error) {
+	ticker := time.NewTicker(watcher.Interval)
+	defer ticker.Stop()
+
+	changed := time.Time{}
+	for {
+		select {
+		case <-stop:
+			return "", nil
+		case <-ticker.C:
+		}
+
+		stamp, err := watchStamp(watcher.Path)
+
+		if err != nil {
+			return "", err
+		}
+
+		if stamp != last {
+			last = stamp
+			changed = time.Now()
+			continue
+		}
+
+		if !changed.IsZero() && time.Since(changed) >= watcher.Debounce {
+			return last, nil
+		}
+	}
+}
+
+func watchStamp(path string) (string, error) {
+	stat, err := os.Stat(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%d", stat.ModTime().UTC().Format(time.RFC3339Nano), stat.Size()), nil
+}
+
+// watchState records the version synced for each package and architecture.
+// It filters out packages already synced and records each package synced.
+type watchState struct {
+	mutex    sync.Mutex
+	Versions map[string]string
+}
+
+func readWatchState(path string) (*watchState, error) {
+	state := &watchState{
+		Versions: map[string]string{},
+	}
+
+	text, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(text, state)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Versions == nil {
+		state.Versions = map[string]string{}
+	}
+
+	return state, nil
+}
+
+func (state *watchState) save(path string) error {
+	state.mutex.Lock()
+	text, err := json.MarshalIndent(state, "", "  ")
+	state.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), __WATCH_STATE_DIR_MODE)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, text)
+}
+
+func (state *watchState) StageName() string {
+	return "watch"
+}
+
+func (state *watchState) Keep(info PackageInfo) (bool, error) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	synced, present := state.Versions[watchKey(info)]
+	return !present || synced != info.GetMetaData(VERSION_KEY), nil
+}
+
+func (state *watchState) Synced(info PackageInfo) error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.Versions[watchKey(info)] = info.GetMetaData(VERSION_KEY)
+	return nil
+}
+
+func watchKey(info PackageInfo) string {
+	return info.System + "/" + info.Name + "/" + info.GetMetaData(ARCHITECTURE_KEY)
+}
+
+const __DEFAULT_WATCH_INTERVAL = 5 * time.Second
+const __WATCH_STATE_DIR_MODE = 0755
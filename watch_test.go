@@ -0,0 +1,66 @@
+package pkgthing
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatchStateKeepsNewVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkgthing-watch")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state", "watch.json")
+	state, err := readWatchState(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bash := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	assertWatchKeep(t, state, bash, true)
+
+	err = state.Synced(bash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertWatchKeep(t, state, bash, false)
+	assertWatchKeep(t, state, testPackageInfo("ubuntu", "bash", "4.4", "i386"), true)
+	assertWatchKeep(t, state, testPackageInfo("ubuntu", "bash", "5.0", "amd64"), true)
+
+	err = state.save(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reread, err := readWatchState(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertWatchKeep(t, reread, bash, false)
+}
+
+func assertWatchKeep(t *testing.T, state *watchState, info PackageInfo, expected bool) {
+	t.Helper()
+
+	keep, err := state.Keep(info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keep != expected {
+		t.Errorf("Expected Keep(%s) to be %v", watchKey(info), expected)
+	}
+}
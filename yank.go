@@ -0,0 +1,140 @@
+package pkgthing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/johnny-morrice/godless/crdt"
+	"github.com/pkg/errors"
+)
+
+// Yank withdraws a single published blob of a package. Godless rows can only
+// be merged, so yanks are recorded alongside the package rather than
+// removing it.
+type Yank struct {
+	IpfsPath  string
+	Reason    string
+	Time      time.Time
+	Signature Signature
+}
+
+func (yank Yank) payload(info PackageInfo) []byte {
+	text := fmt.Sprintf("yank\n%s\n%s\n%s\n%s\n%s", info.System, info.Name, yank.IpfsPath, yank.Reason, yank.Time.UTC().Format(time.RFC3339Nano))
+	return []byte(text)
+}
+
+func (yank Yank) isValid(info PackageInfo) bool {
+	return yank.Signature.Verify(yank.payload(info))
+}
+
+// isAuthorised is true when the yank was signed by a publisher of the
+// package or by one of yankers. Otherwise any key could yank any package.
+func (yank Yank) isAuthorised(info PackageInfo, yankers []KeyReference) bool {
+	key := yank.Signature.Fingerprint
+	return info.IsSignedBy(key) || containsKey(yankers, key)
+}
+
+func (info PackageInfo) IsYanked() bool {
+	for _, yank := range info.Yanks {
+		if yank.isValid(info) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (info PackageInfo) YankReason() string {
+	for _, yank := range info.Yanks {
+		if yank.isValid(info) {
+			return yank.Reason
+		}
+	}
+
+	return ""
+}
+
+func (thing *pkgthing) Yank(info PackageInfo, reason string) error {
+	const failMsg = "Yank failed"
+
+	if thing.Signer == nil {
+		return errors.New(failMsg + ": no signing key")
+	}
+
+	info, err := thing.resolvePath(info)
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	yank := Yank{
+		IpfsPath: info.IpfsPath,
+		Reason:   reason,
+		Time:     time.Now().UTC(),
+	}
+
+	sig, err := thing.Signer.Sign(yank.payload(info))
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	yank.Signature = sig
+
+	err = thing.addRecord(info, __YANKED_KEY, yank)
+
+	if err != nil {
+		return errors.Wrap(err, failMsg)
+	}
+
+	return nil
+}
+
+// resolvePath fills in the IpfsPath of the package Get would choose.
+func (thing *pkgthing) resolvePath(info PackageInfo) (PackageInfo, error) {
+	if info.IpfsPath != "" {
+		return info, nil
+	}
+
+	pack, err := thing.findPackage(info)
+
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	info.IpfsPath = pack.IpfsPath
+	return info, nil
+}
+
+func (thing *pkgthing) addRecord(info PackageInfo, key crdt.EntryName, record interface{}) error {
+	builder := &recordBuilder{}
+	builder.setRecord(info, key, record)
+
+	resp, err := thing.sendQueryWithBuilder(builder)
+
+	thing.logResponse(resp)
+
+	if err != nil {
+		return err
+	}
+
+	thing.searches.invalidate()
+
+	return nil
+}
+
+func yankedError(info PackageInfo, reason string) error {
+	return fmt.Errorf("Package '%s' at '%s' was yanked: %s", info.Name, info.IpfsPath, reason)
+}
+
+func withoutYanked(allInfo []PackageInfo) []PackageInfo {
+	visible := make([]PackageInfo, 0, len(allInfo))
+
+	for _, info := range allInfo {
+		if !info.IsYanked() {
+			visible = append(visible, info)
+		}
+	}
+
+	return visible
+}
@@ -0,0 +1,79 @@
+package pkgthing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestYankAuthorisation(t *testing.T) {
+	publisher := testKey(t)
+	trusted := testKey(t)
+	stranger := testKey(t)
+
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	info.IpfsPath = "bash-path"
+	info = testPublish(t, info, publisher)
+
+	yankers := []KeyReference{trusted.Reference()}
+
+	cases := []struct {
+		signer     Ed25519Key
+		authorised bool
+	}{
+		{publisher, true},
+		{trusted, true},
+		{stranger, false},
+	}
+
+	for i, c := range cases {
+		yank := testYank(t, info, c.signer)
+
+		if !yank.isValid(info) {
+			t.Errorf("Case %d: expected yank signature to verify", i)
+		}
+
+		if yank.isAuthorised(info, yankers) != c.authorised {
+			t.Errorf("Case %d: expected authorised to be %v", i, c.authorised)
+		}
+	}
+}
+
+func TestYankedPackages(t *testing.T) {
+	key := testKey(t)
+
+	info := testPackageInfo("ubuntu", "bash", "4.4", "amd64")
+	info.IpfsPath = "bash-path"
+	info = testPublish(t, info, key)
+
+	yanked := info
+	yanked.Yanks = []Yank{testYank(t, info, key)}
+
+	if !yanked.IsYanked() || yanked.YankReason() != "broken" {
+		t.Error("Expected package to be yanked")
+	}
+
+	visible := withoutYanked([]PackageInfo{info, yanked})
+
+	if len(visible) != 1 || visible[0].IsYanked() {
+		t.Errorf("Expected only the unyanked package but got %v", visible)
+	}
+}
+
+func testYank(t *testing.T, info PackageInfo, signer Signer) Yank {
+	t.Helper()
+
+	yank := Yank{
+		IpfsPath: info.IpfsPath,
+		Reason:   "broken",
+		Time:     time.Now().UTC(),
+	}
+
+	sig, err := signer.Sign(yank.payload(info))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yank.Signature = sig
+	return yank
+}